@@ -2,4 +2,24 @@
 
 JSValue InvokeProxy(JSContext *ctx, JSValueConst this_val, int argc, JSValueConst *argv) {
 	 return proxy(ctx, this_val, argc, argv);
-}
\ No newline at end of file
+}
+
+char *InvokeNormalizeModule(JSContext *ctx, const char *module_base_name, const char *module_name, void *opaque) {
+	 return normalizeModule(ctx, (char *) module_base_name, (char *) module_name);
+}
+
+JSModuleDef *InvokeLoadModule(JSContext *ctx, const char *module_name, void *opaque) {
+	 return loadModule(ctx, (char *) module_name);
+}
+
+int InvokeInterruptHandler(JSRuntime *rt, void *opaque) {
+	 return interruptHandler(rt);
+}
+
+int InvokeInitModule(JSContext *ctx, JSModuleDef *m) {
+	 return initModule(ctx, m);
+}
+
+void InvokeFinalizeFuncPtr(JSRuntime *rt, JSValue val) {
+	 finalizeFuncPtr(rt, val);
+}
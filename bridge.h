@@ -1,14 +1,63 @@
 #include "stdlib.h"
+#include "pthread.h"
 #include "quickjs.h"
+#include "version.h"
 
 extern JSValue InvokeProxy(JSContext *ctx, JSValueConst this_val, int argc, JSValueConst *argv);
+extern char *InvokeNormalizeModule(JSContext *ctx, const char *module_base_name, const char *module_name, void *opaque);
+extern JSModuleDef *InvokeLoadModule(JSContext *ctx, const char *module_name, void *opaque);
+extern int InvokeInterruptHandler(JSRuntime *rt, void *opaque);
+extern int InvokeInitModule(JSContext *ctx, JSModuleDef *m);
+extern void InvokeFinalizeFuncPtr(JSRuntime *rt, JSValue val);
+
+static const char *Version() { return CONFIG_VERSION; }
 
 static JSValue JS_NewNull() { return JS_NULL; }
 static JSValue JS_NewUndefined() { return JS_UNDEFINED; }
 static JSValue JS_NewUninitialized() { return JS_UNINITIALIZED; }
+static JSValue JS_NewException() { return JS_EXCEPTION; }
+
+static void *ValuePtr(JSValue val) { return JS_VALUE_GET_PTR(val); }
+static int ValueHasRefCount(JSValue val) { return JS_VALUE_HAS_REF_COUNT(val); }
+static int ValueGetTag(JSValue val) { return JS_VALUE_GET_NORM_TAG(val); }
+
+static int ValueIdentical(JSValue a, JSValue b) {
+	if (JS_VALUE_GET_NORM_TAG(a) != JS_VALUE_GET_NORM_TAG(b)) return 0;
+	if (JS_VALUE_HAS_REF_COUNT(a)) return JS_VALUE_GET_PTR(a) == JS_VALUE_GET_PTR(b);
+	if (JS_TAG_IS_FLOAT64(JS_VALUE_GET_TAG(a))) return JS_VALUE_GET_FLOAT64(a) == JS_VALUE_GET_FLOAT64(b);
+	return JS_VALUE_GET_INT(a) == JS_VALUE_GET_INT(b);
+}
 
 static JSValue ThrowSyntaxError(JSContext *ctx, const char *fmt) { return JS_ThrowSyntaxError(ctx, "%s", fmt); }
 static JSValue ThrowTypeError(JSContext *ctx, const char *fmt) { return JS_ThrowTypeError(ctx, "%s", fmt); }
 static JSValue ThrowReferenceError(JSContext *ctx, const char *fmt) { return JS_ThrowReferenceError(ctx, "%s", fmt); }
 static JSValue ThrowRangeError(JSContext *ctx, const char *fmt) { return JS_ThrowRangeError(ctx, "%s", fmt); }
-static JSValue ThrowInternalError(JSContext *ctx, const char *fmt) { return JS_ThrowInternalError(ctx, "%s", fmt); }
\ No newline at end of file
+static JSValue ThrowInternalError(JSContext *ctx, const char *fmt) { return JS_ThrowInternalError(ctx, "%s", fmt); }
+
+static void SetModuleLoaderFunc(JSRuntime *rt, int normalize) {
+	JS_SetModuleLoaderFunc(rt, normalize ? InvokeNormalizeModule : NULL, InvokeLoadModule, NULL);
+}
+
+static void SetInterruptHandler(JSRuntime *rt) { JS_SetInterruptHandler(rt, InvokeInterruptHandler, NULL); }
+
+static int NewFuncPtrClass(JSRuntime *rt, JSClassID id) {
+	JSClassDef def = { .class_name = "GoFunction", .finalizer = InvokeFinalizeFuncPtr };
+	return JS_NewClass(rt, id, &def);
+}
+
+static JSValue NewFuncPtr(JSContext *ctx, JSClassID id, int64_t ptr) {
+	JSValue val = JS_NewObjectClass(ctx, id);
+	if (!JS_IsException(val)) JS_SetOpaque(val, (void *) (intptr_t) ptr);
+	return val;
+}
+
+static int64_t GetFuncPtr(JSValueConst val, JSClassID id) { return (int64_t) (intptr_t) JS_GetOpaque(val, id); }
+
+static JSModuleDef *NewCModule(JSContext *ctx, const char *module_name) { return JS_NewCModule(ctx, module_name, InvokeInitModule); }
+
+static JSModuleDef *CompileModule(JSContext *ctx, const char *module_name, const char *code, size_t len) {
+	JSValue val = JS_Eval(ctx, code, len, module_name, JS_EVAL_TYPE_MODULE | JS_EVAL_FLAG_COMPILE_ONLY);
+	if (JS_IsException(val)) return NULL;
+	JS_FreeValue(ctx, val);
+	return JS_VALUE_GET_PTR(val);
+}
\ No newline at end of file
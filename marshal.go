@@ -0,0 +1,626 @@
+package quickjs
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"reflect"
+	"strings"
+	"time"
+)
+
+var timeType = reflect.TypeOf(time.Time{})
+
+// Marshal converts v into a JS value. Structs are converted into objects keyed by their exported field names (or
+// their names given by a `json` struct tag), slices and arrays into arrays, maps with string keys into objects,
+// time.Time into a Date, and []byte into a Uint8Array. Nil pointers, interfaces, slices and maps are converted into
+// null. As with encoding/json, fields tagged with `json:"-"` are skipped, and fields tagged with the omitempty
+// option are skipped should they hold an empty value. An error is returned for values that cannot be converted,
+// such as channels and functions.
+func (ctx *Context) Marshal(v interface{}) (Value, error) { return ctx.marshal(reflect.ValueOf(v)) }
+
+func (ctx *Context) marshal(rv reflect.Value) (Value, error) {
+	if !rv.IsValid() {
+		return ctx.Null(), nil
+	}
+
+	if rv.Type() == timeType {
+		return ctx.date(rv.Interface().(time.Time)), nil
+	}
+
+	switch rv.Kind() {
+	case reflect.Ptr, reflect.Interface:
+		if rv.IsNil() {
+			return ctx.Null(), nil
+		}
+		return ctx.marshal(rv.Elem())
+	case reflect.Bool:
+		return ctx.Bool(rv.Bool()), nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return ctx.Int64(rv.Int()), nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return ctx.Float64(float64(rv.Uint())), nil
+	case reflect.Float32, reflect.Float64:
+		return ctx.Float64(rv.Float()), nil
+	case reflect.String:
+		return ctx.String(rv.String()), nil
+	case reflect.Slice:
+		if rv.IsNil() {
+			return ctx.Null(), nil
+		}
+		if rv.Type().Elem().Kind() == reflect.Uint8 {
+			return ctx.Uint8Array(rv.Bytes()), nil
+		}
+		return ctx.marshalArray(rv)
+	case reflect.Array:
+		return ctx.marshalArray(rv)
+	case reflect.Map:
+		return ctx.marshalMap(rv)
+	case reflect.Struct:
+		return ctx.marshalStruct(rv)
+	}
+
+	return ctx.Undefined(), fmt.Errorf("cannot marshal value of type %s", rv.Type())
+}
+
+func (ctx *Context) marshalArray(rv reflect.Value) (Value, error) {
+	arr := ctx.Array()
+	for i := 0; i < rv.Len(); i++ {
+		val, err := ctx.marshal(rv.Index(i))
+		if err != nil {
+			arr.Free()
+			return val, err
+		}
+		arr.SetByUint32(uint32(i), val)
+	}
+	return arr, nil
+}
+
+func (ctx *Context) marshalMap(rv reflect.Value) (Value, error) {
+	if rv.Type().Key().Kind() != reflect.String {
+		return ctx.Undefined(), fmt.Errorf("cannot marshal map with non-string keys of type %s", rv.Type().Key())
+	}
+	if rv.IsNil() {
+		return ctx.Null(), nil
+	}
+
+	obj := ctx.Object()
+	for it := rv.MapRange(); it.Next(); {
+		val, err := ctx.marshal(it.Value())
+		if err != nil {
+			obj.Free()
+			return val, err
+		}
+		obj.Set(it.Key().String(), val)
+	}
+	return obj, nil
+}
+
+func (ctx *Context) marshalStruct(rv reflect.Value) (Value, error) {
+	obj := ctx.Object()
+	for _, field := range structFields(rv.Type()) {
+		if field.omitEmpty && isEmptyValue(rv.Field(field.index)) {
+			continue
+		}
+
+		val, err := ctx.marshal(rv.Field(field.index))
+		if err != nil {
+			obj.Free()
+			return val, err
+		}
+		obj.Set(field.name, val)
+	}
+	return obj, nil
+}
+
+// MarshalSlice converts a slice or array of structs, or of pointers to structs, into an array of objects. It is
+// equivalent to Marshal, though it interns the names of struct fields once rather than once per element.
+func (ctx *Context) MarshalSlice(v interface{}) (Value, error) {
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Slice && rv.Kind() != reflect.Array {
+		return ctx.Undefined(), fmt.Errorf("cannot marshal value of type %T as a slice", v)
+	}
+
+	typ := rv.Type().Elem()
+	if typ.Kind() == reflect.Ptr {
+		typ = typ.Elem()
+	}
+	if typ.Kind() != reflect.Struct || typ == timeType {
+		return ctx.marshal(rv)
+	}
+	if rv.Kind() == reflect.Slice && rv.IsNil() {
+		return ctx.Null(), nil
+	}
+
+	fields := structFields(typ)
+
+	atoms := make([]Atom, 0, len(fields))
+	for _, field := range fields {
+		atoms = append(atoms, ctx.Atom(field.name))
+	}
+	defer func() {
+		for _, atom := range atoms {
+			atom.Free()
+		}
+	}()
+
+	arr := ctx.ArrayWithCapacity(rv.Len())
+	for i := 0; i < rv.Len(); i++ {
+		row := rv.Index(i)
+		if row.Kind() == reflect.Ptr {
+			if row.IsNil() {
+				arr.SetByUint32(uint32(i), ctx.Null())
+				continue
+			}
+			row = row.Elem()
+		}
+
+		obj := ctx.Object()
+		for j, field := range fields {
+			if field.omitEmpty && isEmptyValue(row.Field(field.index)) {
+				continue
+			}
+
+			val, err := ctx.marshal(row.Field(field.index))
+			if err != nil {
+				obj.Free()
+				arr.Free()
+				return val, err
+			}
+			obj.SetByAtom(atoms[j], val)
+		}
+		arr.SetByUint32(uint32(i), obj)
+	}
+	return arr, nil
+}
+
+type structField struct {
+	index     int
+	name      string
+	omitEmpty bool
+}
+
+// structFields returns the exported fields of typ, named and configured by their `json` struct tags. Fields tagged
+// with `json:"-"` are skipped.
+func structFields(typ reflect.Type) []structField {
+	fields := make([]structField, 0, typ.NumField())
+	for i := 0; i < typ.NumField(); i++ {
+		field := typ.Field(i)
+		if field.PkgPath != "" {
+			continue
+		}
+
+		tag := field.Tag.Get("json")
+		if tag == "-" {
+			continue
+		}
+
+		name, opts := tag, ""
+		if idx := strings.IndexByte(tag, ','); idx >= 0 {
+			name, opts = tag[:idx], tag[idx+1:]
+		}
+		if name == "" {
+			name = field.Name
+		}
+
+		omitEmpty := false
+		for _, opt := range strings.Split(opts, ",") {
+			omitEmpty = omitEmpty || opt == "omitempty"
+		}
+
+		fields = append(fields, structField{index: i, name: name, omitEmpty: omitEmpty})
+	}
+	return fields
+}
+
+func isEmptyValue(rv reflect.Value) bool {
+	switch rv.Kind() {
+	case reflect.Array, reflect.Map, reflect.Slice, reflect.String:
+		return rv.Len() == 0
+	case reflect.Bool:
+		return !rv.Bool()
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return rv.Int() == 0
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return rv.Uint() == 0
+	case reflect.Float32, reflect.Float64:
+		return rv.Float() == 0
+	case reflect.Interface, reflect.Ptr:
+		return rv.IsNil()
+	}
+	return false
+}
+
+// Call2 calls the method of v with the given name, bound to v, passing in args converted into JS values via
+// Marshal.
+func (v Value) Call2(method string, args ...interface{}) (Value, error) {
+	fn := v.Get(method)
+	defer fn.Free()
+
+	if !fn.IsFunction() {
+		return v.ctx.Undefined(), fmt.Errorf("%s is not a function", method)
+	}
+
+	vals := make([]Value, 0, len(args))
+	defer func() {
+		for _, val := range vals {
+			val.Free()
+		}
+	}()
+
+	for _, arg := range args {
+		val, err := v.ctx.Marshal(arg)
+		if err != nil {
+			return val, err
+		}
+		vals = append(vals, val)
+	}
+
+	return fn.Call(v, vals...)
+}
+
+// Unmarshal decodes v into the Go value pointed to by dst, following the same conventions as Marshal. Numbers are
+// converted into the numeric kind of their destination, returning an error should they overflow it or, for integer
+// kinds, should they not be integers. Null and undefined are decoded into nil pointers, slices and maps. A Date
+// decodes into a time.Time, and a typed array or ArrayBuffer decodes into a []byte.
+func (v Value) Unmarshal(dst interface{}) error {
+	rv := reflect.ValueOf(dst)
+	if rv.Kind() != reflect.Ptr || rv.IsNil() {
+		return errors.New("unmarshal destination must be a non-nil pointer")
+	}
+	d := decoder{visiting: make(map[uintptr]struct{})}
+	return d.unmarshal(v, rv.Elem())
+}
+
+// GetOr reads the property of v with the given name, unmarshalled into a T. def is returned should the property be
+// undefined or not be unmarshallable into a T.
+func GetOr[T any](v Value, name string, def T) T {
+	prop := v.Get(name)
+	defer prop.Free()
+
+	if prop.IsUndefined() {
+		return def
+	}
+
+	var result T
+	if err := prop.Unmarshal(&result); err != nil {
+		return def
+	}
+	return result
+}
+
+// ErrCyclicValue is returned when unmarshalling a value that contains a reference to itself.
+var ErrCyclicValue = errors.New("cannot unmarshal cyclic value")
+
+type decoder struct {
+	visiting map[uintptr]struct{}
+}
+
+// enter marks v as being decoded, returning ErrCyclicValue should v already be in the midst of being decoded.
+func (d *decoder) enter(v Value) error {
+	if _, exists := d.visiting[v.ptr()]; exists {
+		return ErrCyclicValue
+	}
+	d.visiting[v.ptr()] = struct{}{}
+	return nil
+}
+
+func (d *decoder) leave(v Value) { delete(d.visiting, v.ptr()) }
+
+func (d *decoder) unmarshal(v Value, rv reflect.Value) error {
+	if rv.Type() == timeType {
+		if !v.IsDate() {
+			return fmt.Errorf("cannot unmarshal non-date value into %s", rv.Type())
+		}
+		rv.Set(reflect.ValueOf(v.time()))
+		return nil
+	}
+
+	switch rv.Kind() {
+	case reflect.Ptr:
+		if v.IsNull() || v.IsUndefined() {
+			rv.Set(reflect.Zero(rv.Type()))
+			return nil
+		}
+		if rv.IsNil() {
+			rv.Set(reflect.New(rv.Type().Elem()))
+		}
+		return d.unmarshal(v, rv.Elem())
+	case reflect.Interface:
+		if rv.NumMethod() != 0 {
+			break
+		}
+		val, err := d.toInterface(v)
+		if err != nil {
+			return err
+		}
+		if val == nil {
+			rv.Set(reflect.Zero(rv.Type()))
+		} else {
+			rv.Set(reflect.ValueOf(val))
+		}
+		return nil
+	case reflect.Bool:
+		rv.SetBool(v.Bool())
+		return nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		f, err := integer(v, rv.Type())
+		if err != nil {
+			return err
+		}
+		if f < -(1<<63) || f >= 1<<63 || rv.OverflowInt(int64(f)) {
+			return fmt.Errorf("number %v overflows %s", f, rv.Type())
+		}
+		rv.SetInt(int64(f))
+		return nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		f, err := integer(v, rv.Type())
+		if err != nil {
+			return err
+		}
+		if f < 0 || f >= 1<<64 || rv.OverflowUint(uint64(f)) {
+			return fmt.Errorf("number %v overflows %s", f, rv.Type())
+		}
+		rv.SetUint(uint64(f))
+		return nil
+	case reflect.Float32, reflect.Float64:
+		if !v.IsNumber() {
+			return fmt.Errorf("cannot unmarshal non-number value into %s", rv.Type())
+		}
+		f := v.Float64()
+		if rv.OverflowFloat(f) {
+			return fmt.Errorf("number %v overflows %s", f, rv.Type())
+		}
+		rv.SetFloat(f)
+		return nil
+	case reflect.String:
+		if !v.IsString() {
+			return fmt.Errorf("cannot unmarshal non-string value into %s", rv.Type())
+		}
+		rv.SetString(v.String())
+		return nil
+	case reflect.Slice:
+		if v.IsNull() || v.IsUndefined() {
+			rv.Set(reflect.Zero(rv.Type()))
+			return nil
+		}
+		if rv.Type().Elem().Kind() == reflect.Uint8 && !v.IsArray() {
+			b, err := v.ToBytes()
+			if err != nil {
+				return err
+			}
+			rv.SetBytes(b)
+			return nil
+		}
+		if !v.IsArray() {
+			return fmt.Errorf("cannot unmarshal non-array value into %s", rv.Type())
+		}
+		rv.Set(reflect.MakeSlice(rv.Type(), int(v.Len()), int(v.Len())))
+		return d.unmarshalArray(v, rv)
+	case reflect.Array:
+		if !v.IsArray() {
+			return fmt.Errorf("cannot unmarshal non-array value into %s", rv.Type())
+		}
+		return d.unmarshalArray(v, rv)
+	case reflect.Map:
+		if rv.Type().Key().Kind() != reflect.String {
+			return fmt.Errorf("cannot unmarshal into map with non-string keys of type %s", rv.Type().Key())
+		}
+		if v.IsNull() || v.IsUndefined() {
+			rv.Set(reflect.Zero(rv.Type()))
+			return nil
+		}
+		if !v.IsObject() {
+			return fmt.Errorf("cannot unmarshal non-object value into %s", rv.Type())
+		}
+		if rv.IsNil() {
+			rv.Set(reflect.MakeMap(rv.Type()))
+		}
+		return d.unmarshalMap(v, rv)
+	case reflect.Struct:
+		if !v.IsObject() {
+			return fmt.Errorf("cannot unmarshal non-object value into %s", rv.Type())
+		}
+		return d.unmarshalStruct(v, rv)
+	}
+
+	return fmt.Errorf("cannot unmarshal into value of type %s", rv.Type())
+}
+
+// integer returns v as a float64 holding an integer, returning an error should v not be an integral number.
+func integer(v Value, typ reflect.Type) (float64, error) {
+	if !v.IsNumber() {
+		return 0, fmt.Errorf("cannot unmarshal non-number value into %s", typ)
+	}
+	f := v.Float64()
+	if math.IsNaN(f) || math.IsInf(f, 0) || f != math.Trunc(f) {
+		return 0, fmt.Errorf("cannot unmarshal non-integer number %v into %s", f, typ)
+	}
+	return f, nil
+}
+
+func (d *decoder) unmarshalArray(v Value, rv reflect.Value) error {
+	if err := d.enter(v); err != nil {
+		return err
+	}
+	defer d.leave(v)
+
+	for i := 0; i < rv.Len() && int64(i) < v.Len(); i++ {
+		item := v.GetByUint32(uint32(i))
+		err := d.unmarshal(item, rv.Index(i))
+		item.Free()
+
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (d *decoder) unmarshalMap(v Value, rv reflect.Value) error {
+	if err := d.enter(v); err != nil {
+		return err
+	}
+	defer d.leave(v)
+
+	names, err := v.PropertyNamesWith(PropertyNamesOwnOnly)
+	if err != nil {
+		return err
+	}
+
+	for _, name := range names {
+		item := v.GetByAtom(name.Atom)
+
+		val := reflect.New(rv.Type().Elem()).Elem()
+		err := d.unmarshal(item, val)
+		item.Free()
+
+		if err != nil {
+			return err
+		}
+		rv.SetMapIndex(reflect.ValueOf(name.String()).Convert(rv.Type().Key()), val)
+	}
+	return nil
+}
+
+func (d *decoder) unmarshalStruct(v Value, rv reflect.Value) error {
+	if err := d.enter(v); err != nil {
+		return err
+	}
+	defer d.leave(v)
+
+	for _, field := range structFields(rv.Type()) {
+		item := v.Get(field.name)
+		if item.IsUndefined() {
+			continue
+		}
+
+		err := d.unmarshal(item, rv.Field(field.index))
+		item.Free()
+
+		if err != nil {
+			return fmt.Errorf("%s: %w", rv.Type().Field(field.index).Name, err)
+		}
+	}
+	return nil
+}
+
+func (d *decoder) toInterface(v Value) (interface{}, error) {
+	switch {
+	case v.IsNull(), v.IsUndefined():
+		return nil, nil
+	case v.IsBool():
+		return v.Bool(), nil
+	case v.IsNumber():
+		return v.Float64(), nil
+	case v.IsString():
+		return v.String(), nil
+	case v.IsArray():
+		var val []interface{}
+		err := d.unmarshal(v, reflect.ValueOf(&val).Elem())
+		return val, err
+	case v.IsDate():
+		return v.time(), nil
+	case v.isArrayBuffer(), v.isUint8Array():
+		return v.ToBytes()
+	case v.IsFunction():
+		return nil, errors.New("cannot unmarshal function value")
+	case v.IsObject():
+		val := make(map[string]interface{})
+		err := d.unmarshalMap(v, reflect.ValueOf(val))
+		return val, err
+	}
+	return nil, errors.New("cannot unmarshal value")
+}
+
+func (v Value) time() time.Time {
+	ms := v.Float64()
+	sec := math.Floor(ms / 1e3)
+	return time.Unix(int64(sec), int64((ms-sec*1e3)*1e6)).UTC()
+}
+
+var errorType = reflect.TypeOf((*error)(nil)).Elem()
+
+// InstallAPI sets a global object named namespace holding the exported fields and methods of api. Fields are
+// marshalled as with Marshal, and methods become functions whose arguments are unmarshalled into the method's
+// parameter types. Methods returning a non-nil error as their last result throw the error as an exception. The
+// global object is only set should all fields and methods of api be converted successfully.
+func (ctx *Context) InstallAPI(namespace string, api interface{}) error {
+	rv := reflect.ValueOf(api)
+	if !rv.IsValid() {
+		return errors.New("cannot install nil api")
+	}
+
+	fields := rv
+	for fields.Kind() == reflect.Ptr {
+		if fields.IsNil() {
+			return fmt.Errorf("cannot install nil api of type %s", rv.Type())
+		}
+		fields = fields.Elem()
+	}
+	if fields.Kind() != reflect.Struct {
+		return fmt.Errorf("cannot install api of type %s", rv.Type())
+	}
+
+	obj, err := ctx.marshalStruct(fields)
+	if err != nil {
+		return err
+	}
+
+	for i := 0; i < rv.NumMethod(); i++ {
+		obj.Set(rv.Type().Method(i).Name, ctx.Function(methodFunction(rv.Method(i))))
+	}
+
+	ctx.Globals().Set(namespace, obj)
+	return nil
+}
+
+func methodFunction(method reflect.Value) Function {
+	typ := method.Type()
+
+	return func(ctx *Context, this Value, args []Value) Value {
+		in := make([]reflect.Value, typ.NumIn())
+		for i := range in {
+			in[i] = reflect.New(typ.In(i)).Elem()
+		}
+		if typ.IsVariadic() {
+			in = in[:len(in)-1]
+		}
+
+		for i, arg := range args {
+			var dst reflect.Value
+			switch {
+			case i < len(in):
+				dst = in[i]
+			case typ.IsVariadic():
+				dst = reflect.New(typ.In(typ.NumIn() - 1).Elem()).Elem()
+				in = append(in, dst)
+			default:
+				continue
+			}
+
+			d := decoder{visiting: make(map[uintptr]struct{})}
+			if err := d.unmarshal(arg, dst); err != nil {
+				return ctx.ThrowTypeError("argument %d: %s", i, err)
+			}
+		}
+
+		out := method.Call(in)
+
+		if n := len(out); n > 0 && typ.Out(n-1) == errorType {
+			if err, _ := out[n-1].Interface().(error); err != nil {
+				return ctx.ThrowError(err)
+			}
+			out = out[:n-1]
+		}
+		if len(out) == 0 {
+			return ctx.Undefined()
+		}
+
+		val, err := ctx.marshal(out[0])
+		if err != nil {
+			return ctx.ThrowTypeError("%s", err)
+		}
+		return val
+	}
+}
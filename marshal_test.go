@@ -0,0 +1,371 @@
+package quickjs
+
+import (
+	"errors"
+	"github.com/stretchr/testify/require"
+	"testing"
+	"time"
+)
+
+func TestMarshalTimeAndBytes(t *testing.T) {
+	runtime := NewRuntime()
+	defer runtime.Free()
+
+	context := runtime.NewContext()
+	defer context.Free()
+
+	createdAt := time.Date(2020, time.July, 14, 12, 30, 0, 0, time.UTC)
+
+	val, err := context.Marshal(struct {
+		CreatedAt time.Time `json:"createdAt"`
+		Data      []byte    `json:"data"`
+		Empty     []byte    `json:"empty"`
+	}{
+		CreatedAt: createdAt,
+		Data:      []byte{1, 2, 255},
+		Empty:     []byte{},
+	})
+	require.NoError(t, err)
+	context.Globals().Set("record", val)
+
+	result, err := context.Eval(`record.createdAt instanceof Date && record.createdAt.getTime()`)
+	require.NoError(t, err)
+	defer result.Free()
+
+	require.EqualValues(t, createdAt.UnixNano()/int64(time.Millisecond), result.Int64())
+
+	result, err = context.Eval(`record.data instanceof Uint8Array && Array.from(record.data).join(",")`)
+	require.NoError(t, err)
+	defer result.Free()
+
+	require.EqualValues(t, "1,2,255", result.String())
+
+	result, err = context.Eval(`record.empty instanceof Uint8Array && record.empty.length`)
+	require.NoError(t, err)
+	defer result.Free()
+
+	require.EqualValues(t, 0, result.Int64())
+}
+
+func TestUnmarshalDateAndBytes(t *testing.T) {
+	runtime := NewRuntime()
+	defer runtime.Free()
+
+	context := runtime.NewContext()
+	defer context.Free()
+
+	val, err := context.Eval(`({
+		name: "record",
+		createdAt: new Date(Date.UTC(2020, 6, 14, 12, 30)),
+		data: new Uint8Array([1, 2, 255]),
+		view: new Uint8Array([0, 1, 2, 3]).subarray(1, 3),
+		tags: ["a", "b"],
+	})`)
+	require.NoError(t, err)
+	defer val.Free()
+
+	var record struct {
+		Name      string    `json:"name"`
+		CreatedAt time.Time `json:"createdAt"`
+		Data      []byte    `json:"data"`
+		View      []byte    `json:"view"`
+		Tags      []string  `json:"tags"`
+	}
+	require.NoError(t, val.Unmarshal(&record))
+
+	require.EqualValues(t, "record", record.Name)
+	require.True(t, record.CreatedAt.Equal(time.Date(2020, time.July, 14, 12, 30, 0, 0, time.UTC)))
+	require.EqualValues(t, []byte{1, 2, 255}, record.Data)
+	require.EqualValues(t, []byte{1, 2}, record.View)
+	require.EqualValues(t, []string{"a", "b"}, record.Tags)
+
+	var generic map[string]interface{}
+	require.NoError(t, val.Unmarshal(&generic))
+
+	require.IsType(t, time.Time{}, generic["createdAt"])
+	require.EqualValues(t, []byte{1, 2, 255}, generic["data"])
+	require.EqualValues(t, []interface{}{"a", "b"}, generic["tags"])
+}
+
+func TestUnmarshalCycle(t *testing.T) {
+	runtime := NewRuntime()
+	defer runtime.Free()
+
+	context := runtime.NewContext()
+	defer context.Free()
+
+	val, err := context.Eval(`const cyclic = {name: "root", children: []}; cyclic.children.push(cyclic); cyclic`)
+	require.NoError(t, err)
+	defer val.Free()
+
+	var generic interface{}
+	require.True(t, errors.Is(val.Unmarshal(&generic), ErrCyclicValue))
+
+	type node struct {
+		Name     string  `json:"name"`
+		Children []*node `json:"children"`
+	}
+
+	var typed node
+	require.True(t, errors.Is(val.Unmarshal(&typed), ErrCyclicValue))
+
+	shared, err := context.Eval(`const leaf = {name: "leaf"}; ({name: "root", children: [leaf, leaf]})`)
+	require.NoError(t, err)
+	defer shared.Free()
+
+	require.NoError(t, shared.Unmarshal(&typed))
+	require.Len(t, typed.Children, 2)
+	require.EqualValues(t, "leaf", typed.Children[1].Name)
+}
+
+type greeter struct {
+	Version string
+	secret  string
+}
+
+func (g greeter) Greet(name string) string { return "Hello, " + name + "!" }
+
+func (g greeter) Sum(nums ...int) int {
+	total := 0
+	for _, num := range nums {
+		total += num
+	}
+	return total
+}
+
+func (g greeter) Fail() (string, error) { return "", errors.New("failed") }
+
+func TestInstallAPI(t *testing.T) {
+	runtime := NewRuntime()
+	defer runtime.Free()
+
+	context := runtime.NewContext()
+	defer context.Free()
+
+	require.NoError(t, context.InstallAPI("api", greeter{Version: "1.0.0", secret: "hidden"}))
+
+	result, err := context.Eval(`[api.Version, api.Greet("world"), api.Sum(1, 2, 3), typeof api.secret].join(" ")`)
+	require.NoError(t, err)
+	defer result.Free()
+
+	require.EqualValues(t, "1.0.0 Hello, world! 6 undefined", result.String())
+
+	_, err = context.Eval(`api.Fail()`)
+	require.EqualError(t, err, "Error: failed")
+
+	_, err = context.Eval(`api.Greet(1)`)
+	require.Error(t, err)
+
+	require.Error(t, context.InstallAPI("invalid", 1))
+	require.EqualError(t, context.InstallAPI("missing", nil), "cannot install nil api")
+	require.EqualError(t, context.InstallAPI("missing", (*greeter)(nil)), "cannot install nil api of type *quickjs.greeter")
+}
+
+type marshalRow struct {
+	ID    int    `json:"id"`
+	Name  string `json:"name"`
+	Admin bool   `json:"admin"`
+}
+
+func marshalRows(n int) []marshalRow {
+	rows := make([]marshalRow, n)
+	for i := range rows {
+		rows[i] = marshalRow{ID: i, Name: "user", Admin: i%2 == 0}
+	}
+	return rows
+}
+
+func TestMarshalSlice(t *testing.T) {
+	runtime := NewRuntime()
+	defer runtime.Free()
+
+	context := runtime.NewContext()
+	defer context.Free()
+
+	val, err := context.MarshalSlice(marshalRows(3))
+	require.NoError(t, err)
+	defer val.Free()
+
+	json, _, err := val.JSONStringifyLimit(1 << 20)
+	require.NoError(t, err)
+	require.EqualValues(t, `[{"id":0,"name":"user","admin":true},{"id":1,"name":"user","admin":false},{"id":2,"name":"user","admin":true}]`, json)
+
+	val, err = context.MarshalSlice([]*marshalRow{{ID: 7}, nil})
+	require.NoError(t, err)
+	defer val.Free()
+
+	json, _, err = val.JSONStringifyLimit(1 << 20)
+	require.NoError(t, err)
+	require.EqualValues(t, `[{"id":7,"name":"","admin":false},null]`, json)
+
+	_, err = context.MarshalSlice(marshalRow{})
+	require.Error(t, err)
+}
+
+func BenchmarkMarshal(b *testing.B) {
+	runtime := NewRuntime()
+	defer runtime.Free()
+
+	context := runtime.NewContext()
+	defer context.Free()
+
+	rows := marshalRows(10000)
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		val, err := context.Marshal(rows)
+		if err != nil {
+			b.Fatal(err)
+		}
+		val.Free()
+	}
+}
+
+func BenchmarkMarshalSlice(b *testing.B) {
+	runtime := NewRuntime()
+	defer runtime.Free()
+
+	context := runtime.NewContext()
+	defer context.Free()
+
+	rows := marshalRows(10000)
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		val, err := context.MarshalSlice(rows)
+		if err != nil {
+			b.Fatal(err)
+		}
+		val.Free()
+	}
+}
+
+func TestCall2(t *testing.T) {
+	runtime := NewRuntime()
+	defer runtime.Free()
+
+	context := runtime.NewContext()
+	defer context.Free()
+
+	str := context.String("42")
+	defer str.Free()
+
+	padded, err := str.Call2("padStart", 5, "0")
+	require.NoError(t, err)
+	defer padded.Free()
+
+	require.EqualValues(t, "00042", padded.String())
+
+	_, err = str.Call2("missing")
+	require.EqualError(t, err, "missing is not a function")
+}
+
+func TestGetOr(t *testing.T) {
+	runtime := NewRuntime()
+	defer runtime.Free()
+
+	context := runtime.NewContext()
+	defer context.Free()
+
+	obj, err := context.Eval(`({ port: 8080, host: "localhost" })`)
+	require.NoError(t, err)
+	defer obj.Free()
+
+	require.EqualValues(t, 8080, GetOr(obj, "port", int64(80)))
+	require.EqualValues(t, 80, GetOr(obj, "missing", int64(80)))
+	require.EqualValues(t, 80, GetOr(obj, "host", int64(80)))
+
+	require.EqualValues(t, "localhost", GetOr(obj, "host", "0.0.0.0"))
+	require.EqualValues(t, "0.0.0.0", GetOr(obj, "missing", "0.0.0.0"))
+	require.EqualValues(t, "0.0.0.0", GetOr(obj, "port", "0.0.0.0"))
+}
+
+func TestMarshalTags(t *testing.T) {
+	runtime := NewRuntime()
+	defer runtime.Free()
+
+	context := runtime.NewContext()
+	defer context.Free()
+
+	type nested struct {
+		Value int `json:"value"`
+	}
+
+	type tagged struct {
+		Name     string            `json:"name"`
+		Secret   string            `json:"-"`
+		Dash     string            `json:"-,"`
+		Count    int               `json:"count,omitempty"`
+		Tags     []string          `json:"tags,omitempty"`
+		Labels   map[string]string `json:"labels,omitempty"`
+		Nested   *nested           `json:"nested,omitempty"`
+		Missing  *nested           `json:"missing"`
+		Any      interface{}       `json:"any"`
+		Default  bool
+		internal bool
+	}
+
+	val, err := context.Marshal(tagged{Name: "quickjs", Secret: "hidden", Dash: "dash", Nested: &nested{Value: 1}})
+	require.NoError(t, err)
+	defer val.Free()
+
+	json, _, err := val.JSONStringifyLimit(1 << 20)
+	require.NoError(t, err)
+	require.EqualValues(t, `{"name":"quickjs","-":"dash","nested":{"value":1},"missing":null,"any":null,"Default":false}`, json)
+
+	_, err = context.Marshal(make(chan int))
+	require.EqualError(t, err, "cannot marshal value of type chan int")
+
+	_, err = context.Marshal(struct{ Fn func() }{})
+	require.EqualError(t, err, "cannot marshal value of type func()")
+
+	var decoded tagged
+	require.NoError(t, val.Unmarshal(&decoded))
+	require.EqualValues(t, tagged{Name: "quickjs", Dash: "dash", Nested: &nested{Value: 1}}, decoded)
+}
+
+func TestUnmarshalNumbers(t *testing.T) {
+	runtime := NewRuntime()
+	defer runtime.Free()
+
+	context := runtime.NewContext()
+	defer context.Free()
+
+	type response struct {
+		ID     uint16   `json:"id"`
+		Delta  int8     `json:"delta"`
+		Score  float32  `json:"score"`
+		Next   *int     `json:"next"`
+		Scores []uint32 `json:"scores"`
+	}
+
+	val, err := context.Eval(`({ id: 65535, delta: -128, score: 0.5, next: null, scores: [1, 2, 3] })`)
+	require.NoError(t, err)
+	defer val.Free()
+
+	out := response{Next: new(int)}
+	require.NoError(t, val.Unmarshal(&out))
+	require.EqualValues(t, response{ID: 65535, Delta: -128, Score: 0.5, Scores: []uint32{1, 2, 3}}, out)
+
+	tests := []struct {
+		code string
+		err  string
+	}{
+		{`({ id: 65536 })`, "ID: number 65536 overflows uint16"},
+		{`({ id: -1 })`, "ID: number -1 overflows uint16"},
+		{`({ delta: 128 })`, "Delta: number 128 overflows int8"},
+		{`({ delta: 1.5 })`, "Delta: cannot unmarshal non-integer number 1.5 into int8"},
+		{`({ delta: NaN })`, "Delta: cannot unmarshal non-integer number NaN into int8"},
+		{`({ score: 1e39 })`, "Score: number 1e+39 overflows float32"},
+		{`({ scores: [1, "2"] })`, "Scores: cannot unmarshal non-number value into uint32"},
+	}
+
+	for _, test := range tests {
+		val, err := context.Eval(test.code)
+		require.NoError(t, err)
+
+		var out response
+		require.EqualError(t, val.Unmarshal(&out), test.err, test.code)
+		val.Free()
+	}
+}
@@ -0,0 +1,261 @@
+package quickjs
+
+import (
+	"crypto/rand"
+	"sort"
+	"strings"
+	"time"
+)
+
+const maxRandomValuesLength = 65536
+
+// EnableCrypto installs a global crypto object exposing getRandomValues, which fills an integer typed array with
+// cryptographically secure random values read from crypto/rand.
+func (ctx *Context) EnableCrypto() {
+	crypto := ctx.Globals().Get("crypto")
+	if !crypto.IsObject() {
+		crypto.Free()
+		crypto = ctx.Object()
+		ctx.Globals().Set("crypto", crypto.Dup())
+	}
+	defer crypto.Free()
+
+	crypto.SetFunction("getRandomValues", func(ctx *Context, this Value, args []Value) Value {
+		if len(args) == 0 || !args[0].isTypedArray() || args[0].isFloatArray() {
+			return ctx.ThrowTypeError("getRandomValues expects an integer typed array")
+		}
+
+		buf, err := args[0].bufferView()
+		if err != nil {
+			return ctx.ThrowError(err)
+		}
+		if len(buf) > maxRandomValuesLength {
+			return ctx.ThrowRangeError("getRandomValues cannot fill more than %d bytes", maxRandomValuesLength)
+		}
+		if _, err := rand.Read(buf); err != nil {
+			return ctx.ThrowError(err)
+		}
+
+		return args[0].Dup()
+	})
+}
+
+// EnableTextCodec installs the global TextEncoder and TextDecoder classes, which convert between strings and UTF-8
+// encoded Uint8Arrays.
+func (ctx *Context) EnableTextCodec() {
+	val := ctx.eval(`(encode, decode) => {
+		const labels = ["utf-8", "utf8", "unicode-1-1-utf-8"];
+
+		class TextEncoder {
+			get encoding() { return "utf-8"; }
+			encode(input = "") { return encode(String(input)); }
+		}
+
+		class TextDecoder {
+			constructor(label = "utf-8") {
+				if (!labels.includes(String(label).trim().toLowerCase())) {
+					throw new RangeError("The encoding '" + label + "' is not supported");
+				}
+			}
+			get encoding() { return "utf-8"; }
+			decode(input) { return input === undefined ? "" : decode(input); }
+		}
+
+		globalThis.TextEncoder = TextEncoder;
+		globalThis.TextDecoder = TextDecoder;
+	}`)
+	if val.IsException() {
+		return
+	}
+	defer val.Free()
+
+	encode := ctx.Function(func(ctx *Context, this Value, args []Value) Value {
+		return ctx.Uint8Array([]byte(args[0].String()))
+	})
+	defer encode.Free()
+
+	decode := ctx.Function(func(ctx *Context, this Value, args []Value) Value {
+		buf, err := args[0].bufferView()
+		if err != nil {
+			return ctx.ThrowError(err)
+		}
+		return ctx.String(strings.TrimPrefix(strings.ToValidUTF8(string(buf), "\uFFFD"), "\uFEFF"))
+	})
+	defer decode.Free()
+
+	result := ctx.call(val, ctx.Null(), encode, decode)
+	result.Free()
+}
+
+// EnableStructuredClone installs the global structuredClone function, which deep-copies values made up of plain
+// objects, arrays, Maps, Sets, Dates, ArrayBuffers and typed arrays while preserving cyclic references. Dates,
+// ArrayBuffers and typed arrays are copied through the engine's serializer.
+func (ctx *Context) EnableStructuredClone() {
+	val := ctx.eval(`(copy) => {
+		const clone = (value, seen) => {
+			if (typeof value === "function" || typeof value === "symbol") {
+				throw new TypeError(String(value) + " could not be cloned");
+			}
+			if (value === null || typeof value !== "object") return value;
+			if (seen.has(value)) return seen.get(value);
+
+			let result;
+			if (value instanceof Date || value instanceof ArrayBuffer || ArrayBuffer.isView(value)) {
+				result = copy(value);
+				seen.set(value, result);
+			} else if (value instanceof Map) {
+				result = new Map();
+				seen.set(value, result);
+				for (const [k, v] of value) result.set(clone(k, seen), clone(v, seen));
+			} else if (value instanceof Set) {
+				result = new Set();
+				seen.set(value, result);
+				for (const v of value) result.add(clone(v, seen));
+			} else {
+				result = Array.isArray(value) ? new Array(value.length) : {};
+				seen.set(value, result);
+				for (const key of Object.keys(value)) result[key] = clone(value[key], seen);
+			}
+			return result;
+		};
+
+		globalThis.structuredClone = (value) => clone(value, new Map());
+	}`)
+	if val.IsException() {
+		return
+	}
+	defer val.Free()
+
+	serialize := ctx.Function(func(ctx *Context, this Value, args []Value) Value {
+		return ctx.copy(args[0])
+	})
+	defer serialize.Free()
+
+	result := ctx.call(val, ctx.Null(), serialize)
+	result.Free()
+}
+
+type timerState struct {
+	fire Value
+	due  map[int64]time.Time
+}
+
+// EnableTimers installs the global setTimeout and clearTimeout functions. Timers only ever fire through RunTimers,
+// which event loops are expected to call once PendingTimers and NextTimerDue report a timer to be due.
+func (ctx *Context) EnableTimers() {
+	val := ctx.eval(`(schedule, cancel) => {
+		const callbacks = new Map();
+		let nextId = 1;
+
+		globalThis.setTimeout = (fn, delay = 0, ...args) => {
+			const id = nextId++;
+			callbacks.set(id, () => fn(...args));
+			schedule(id, Number(delay) || 0);
+			return id;
+		};
+		globalThis.clearTimeout = (id) => {
+			if (callbacks.delete(id)) cancel(id);
+		};
+
+		return (id) => {
+			const callback = callbacks.get(id);
+			callbacks.delete(id);
+			callback();
+		};
+	}`)
+	if val.IsException() {
+		return
+	}
+	defer val.Free()
+
+	schedule := ctx.Function(func(ctx *Context, this Value, args []Value) Value {
+		delay := time.Duration(args[1].Float64() * float64(time.Millisecond))
+		if delay < 0 {
+			delay = 0
+		}
+		ctx.timers.due[args[0].Int64()] = time.Now().Add(delay)
+		return ctx.Undefined()
+	})
+	defer schedule.Free()
+
+	cancel := ctx.Function(func(ctx *Context, this Value, args []Value) Value {
+		delete(ctx.timers.due, args[0].Int64())
+		return ctx.Undefined()
+	})
+	defer cancel.Free()
+
+	fire := ctx.call(val, ctx.Null(), schedule, cancel)
+	if fire.IsException() {
+		fire.Free()
+		return
+	}
+
+	if ctx.timers != nil {
+		ctx.timers.fire.Free()
+	}
+	ctx.timers = &timerState{fire: fire, due: make(map[int64]time.Time)}
+}
+
+// PendingTimers returns the number of timers that were scheduled but have yet to fire or be cleared.
+func (ctx *Context) PendingTimers() int {
+	if ctx.timers == nil {
+		return 0
+	}
+	return len(ctx.timers.due)
+}
+
+// NextTimerDue returns how long until the soonest pending timer is due, or false should there be no pending timers.
+// A timer that is already overdue is reported as due in zero time.
+func (ctx *Context) NextTimerDue() (time.Duration, bool) {
+	if ctx.PendingTimers() == 0 {
+		return 0, false
+	}
+
+	var next time.Time
+	for _, due := range ctx.timers.due {
+		if next.IsZero() || due.Before(next) {
+			next = due
+		}
+	}
+
+	wait := time.Until(next)
+	if wait < 0 {
+		wait = 0
+	}
+	return wait, true
+}
+
+// RunTimers fires all pending timers that are due in the order they are due, stopping at the first timer that
+// throws.
+func (ctx *Context) RunTimers() error {
+	if ctx.timers == nil {
+		return nil
+	}
+
+	now := time.Now()
+
+	var ids []int64
+	for id, due := range ctx.timers.due {
+		if !due.After(now) {
+			ids = append(ids, id)
+		}
+	}
+	sort.Slice(ids, func(i, j int) bool {
+		a, b := ctx.timers.due[ids[i]], ctx.timers.due[ids[j]]
+		return a.Before(b) || (a.Equal(b) && ids[i] < ids[j])
+	})
+
+	for _, id := range ids {
+		if _, pending := ctx.timers.due[id]; !pending {
+			continue
+		}
+		delete(ctx.timers.due, id)
+
+		result, err := ctx.timers.fire.Call(ctx.Null(), ctx.Int64(id))
+		result.Free()
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,160 @@
+package quickjs
+
+import (
+	"github.com/stretchr/testify/require"
+	"testing"
+	"time"
+)
+
+func TestEnableCrypto(t *testing.T) {
+	runtime := NewRuntime()
+	defer runtime.Free()
+
+	context := runtime.NewContext()
+	defer context.Free()
+
+	context.EnableCrypto()
+
+	result, err := context.Eval(`
+		const buf = new Uint8Array(64);
+		crypto.getRandomValues(buf) === buf && buf.some(b => b !== 0)
+	`)
+	require.NoError(t, err)
+	defer result.Free()
+
+	require.True(t, result.Bool())
+
+	result, err = context.Eval(`
+		const backing = new Uint8Array(32);
+		crypto.getRandomValues(new Uint32Array(backing.buffer, 8, 4));
+		backing.slice(0, 8).every(b => b === 0) && backing.slice(24).every(b => b === 0) && backing.slice(8, 24).some(b => b !== 0)
+	`)
+	require.NoError(t, err)
+	defer result.Free()
+
+	require.True(t, result.Bool())
+
+	_, err = context.Eval(`crypto.getRandomValues(new Float64Array(4))`)
+	require.Error(t, err)
+
+	_, err = context.Eval(`crypto.getRandomValues(new Uint8Array(65537))`)
+	require.Error(t, err)
+}
+
+func TestEnableTextCodec(t *testing.T) {
+	runtime := NewRuntime()
+	defer runtime.Free()
+
+	context := runtime.NewContext()
+	defer context.Free()
+
+	context.EnableTextCodec()
+
+	result, err := context.Eval(`
+		const encoded = new TextEncoder().encode("héllo");
+		encoded instanceof Uint8Array && encoded.length === 6 && new TextDecoder().decode(encoded)
+	`)
+	require.NoError(t, err)
+	defer result.Free()
+
+	require.EqualValues(t, "héllo", result.String())
+
+	result, err = context.Eval(`new TextDecoder().decode(new Uint8Array([0xef, 0xbb, 0xbf, 0x61, 0x00, 0x62, 0xff]).buffer)`)
+	require.NoError(t, err)
+	defer result.Free()
+
+	require.EqualValues(t, "a\x00b�", result.String())
+
+	_, err = context.Eval(`new TextDecoder("latin1")`)
+	require.Error(t, err)
+}
+
+func TestEnableStructuredClone(t *testing.T) {
+	runtime := NewRuntime()
+	defer runtime.Free()
+
+	context := runtime.NewContext()
+	defer context.Free()
+
+	context.EnableStructuredClone()
+
+	result, err := context.Eval(`
+		const original = {
+			name: "original",
+			createdAt: new Date(0),
+			nested: {tags: ["a", "b"]},
+			bytes: new Uint8Array([1, 2, 3]),
+			lookup: new Map([["key", {value: 1}]]),
+			unique: new Set([1, 2]),
+		};
+		original.self = original;
+
+		const copy = structuredClone(original);
+
+		original.name = "changed";
+		original.createdAt.setTime(1000);
+		original.nested.tags.push("c");
+		original.bytes[0] = 9;
+		original.lookup.get("key").value = 2;
+		original.unique.add(3);
+
+		[
+			copy !== original,
+			copy.name === "original",
+			copy.createdAt instanceof Date && copy.createdAt.getTime() === 0,
+			copy.nested.tags.join(",") === "a,b",
+			copy.bytes instanceof Uint8Array && copy.bytes.join(",") === "1,2,3",
+			copy.lookup instanceof Map && copy.lookup.get("key").value === 1,
+			copy.unique instanceof Set && copy.unique.size === 2,
+			copy.self === copy,
+		].every(Boolean)
+	`)
+	require.NoError(t, err)
+	defer result.Free()
+
+	require.True(t, result.Bool())
+
+	_, err = context.Eval(`structuredClone({fn() {}})`)
+	require.Error(t, err)
+}
+
+func TestPendingTimers(t *testing.T) {
+	runtime := NewRuntime()
+	defer runtime.Free()
+
+	context := runtime.NewContext()
+	defer context.Free()
+
+	_, ok := context.NextTimerDue()
+	require.False(t, ok)
+
+	context.EnableTimers()
+
+	result, err := context.Eval(`
+		fired = [];
+		setTimeout(() => fired.push("slow"), 60000);
+		setTimeout((name) => fired.push(name), 0, "fast");
+	`)
+	require.NoError(t, err)
+	defer result.Free()
+
+	require.EqualValues(t, 2, context.PendingTimers())
+
+	due, ok := context.NextTimerDue()
+	require.True(t, ok)
+	require.True(t, due < time.Second)
+
+	require.NoError(t, context.RunTimers())
+	require.EqualValues(t, 1, context.PendingTimers())
+
+	due, ok = context.NextTimerDue()
+	require.True(t, ok)
+	require.True(t, due > 59*time.Second)
+
+	result, err = context.Eval(`clearTimeout(1); fired.join(",")`)
+	require.NoError(t, err)
+	defer result.Free()
+
+	require.EqualValues(t, "fast", result.String())
+	require.EqualValues(t, 0, context.PendingTimers())
+}
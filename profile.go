@@ -0,0 +1,65 @@
+package quickjs
+
+import "errors"
+
+// EnableProfiler starts counting calls to functions set through SetFunction or SetGlobalFunction, and to functions
+// instrumented through Profile. Counts are reported by ProfileReport. Enabling the profiler again resets all counts.
+func (ctx *Context) EnableProfiler() {
+	ctx.profile = make(map[string]int64)
+}
+
+// DisableProfiler stops counting calls and discards all counts.
+func (ctx *Context) DisableProfiler() {
+	ctx.profile = nil
+}
+
+// ProfileReport returns a copy of the number of times each function was called, keyed by function name, since the
+// profiler was enabled. It returns nil should the profiler not be enabled.
+func (ctx *Context) ProfileReport() map[string]int64 {
+	if ctx.profile == nil {
+		return nil
+	}
+
+	report := make(map[string]int64, len(ctx.profile))
+	for name, count := range ctx.profile {
+		report[name] = count
+	}
+	return report
+}
+
+// Profile returns a proxy of the function fn whose calls are counted under name while the profiler is enabled. The
+// proxy behaves as fn otherwise, including when constructed with new. The returned value must be freed.
+func (ctx *Context) Profile(name string, fn Value) (Value, error) {
+	if !fn.IsCallable() {
+		return ctx.Undefined(), errors.New("value is not a function")
+	}
+
+	val := ctx.eval(`(name, fn, count) => new Proxy(fn, {
+		apply(target, thisArg, args) { count(name); return Reflect.apply(target, thisArg, args); },
+		construct(target, args, newTarget) { count(name); return Reflect.construct(target, args, newTarget); },
+	})`)
+	if val.IsException() {
+		return val, ctx.Exception()
+	}
+	defer val.Free()
+
+	count := ctx.Function(func(ctx *Context, this Value, args []Value) Value {
+		ctx.countCall(args[0].String())
+		return ctx.Undefined()
+	})
+	if count.IsException() {
+		return count, ctx.Exception()
+	}
+	defer count.Free()
+
+	nameVal := ctx.String(name)
+	defer nameVal.Free()
+
+	return val.Call(ctx.Null(), nameVal, fn, count)
+}
+
+func (ctx *Context) countCall(name string) {
+	if ctx.profile != nil {
+		ctx.profile[name]++
+	}
+}
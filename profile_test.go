@@ -0,0 +1,54 @@
+package quickjs
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestProfiler(t *testing.T) {
+	runtime := NewRuntime()
+	defer runtime.Free()
+
+	context := runtime.NewContext()
+	defer context.Free()
+
+	require.Nil(t, context.ProfileReport())
+
+	context.SetGlobalFunction("log", func(ctx *Context, this Value, args []Value) Value { return ctx.Undefined() })
+
+	fib, err := context.Eval(`(function fib(n) { return n < 2 ? n : fib(n - 1) + fib(n - 2); })`)
+	require.NoError(t, err)
+	defer fib.Free()
+
+	profiled, err := context.Profile("fib", fib)
+	require.NoError(t, err)
+	context.Globals().Set("profiledFib", profiled)
+
+	context.EnableProfiler()
+
+	result, err := context.Eval(`
+		let total = 0;
+		for (let i = 0; i < 100; i++) {
+			total += profiledFib(5);
+			if (i % 10 === 0) log(i);
+		}
+		total
+	`)
+	require.NoError(t, err)
+	defer result.Free()
+	require.EqualValues(t, 500, result.Int32())
+
+	require.EqualValues(t, map[string]int64{"fib": 100, "log": 10}, context.ProfileReport())
+
+	context.DisableProfiler()
+
+	log, err := context.Eval(`log(1)`)
+	require.NoError(t, err)
+	log.Free()
+	require.Nil(t, context.ProfileReport())
+
+	num := context.Int32(1)
+	_, err = context.Profile("num", num)
+	require.EqualError(t, err, "value is not a function")
+}
@@ -1570,10 +1570,23 @@ static inline uint8_t *js_get_stack_pointer(void)
     return __builtin_frame_address(0);
 }
 
+/* Patched: the upstream check measures the stack against rt->stack_top, the
+   stack pointer observed when the runtime was created. A runtime driven from
+   Go may be used from any OS thread a goroutine lands on, against whose stack
+   rt->stack_top is meaningless, so that the check either fires spuriously or
+   never fires at all. Instead, the highest stack pointer observed on the
+   current thread is tracked as a high-water mark approximating the base of
+   its stack, and is raised lazily whenever a check runs higher up the stack. */
+static __thread uint8_t *js_stack_top;
+
 static inline BOOL js_check_stack_overflow(JSRuntime *rt, size_t alloca_size)
 {
+    uint8_t *sp;
     size_t size;
-    size = rt->stack_top - js_get_stack_pointer();
+    sp = js_get_stack_pointer();
+    if (unlikely(sp > js_stack_top))
+        js_stack_top = sp;
+    size = js_stack_top - sp;
     return unlikely((size + alloca_size) > rt->stack_size);
 }
 #endif
@@ -4866,6 +4879,29 @@ JSValue JS_NewArray(JSContext *ctx)
                                  JS_CLASS_ARRAY);
 }
 
+/* Patched: create an array of length len whose storage for len elements is
+   reserved upfront. Setting the length of a fast array does not allocate,
+   so that filling it in order would otherwise reallocate as it grows. */
+JSValue JS_NewArrayWithCapacity(JSContext *ctx, uint32_t len)
+{
+    JSValue arr, *values;
+    JSObject *p;
+
+    arr = JS_NewArray(ctx);
+    if (JS_IsException(arr) || len == 0)
+        return arr;
+    p = JS_VALUE_GET_OBJ(arr);
+    values = js_realloc(ctx, p->u.array.u.values, sizeof(JSValue) * len);
+    if (!values) {
+        JS_FreeValue(ctx, arr);
+        return JS_EXCEPTION;
+    }
+    p->u.array.u.values = values;
+    p->u.array.u1.size = len;
+    p->prop[0].u.value = JS_NewUint32(ctx, len);
+    return arr;
+}
+
 JSValue JS_NewObject(JSContext *ctx)
 {
     /* inline JS_NewObjectClass(ctx, JS_CLASS_OBJECT); */
@@ -6348,10 +6384,17 @@ static int find_line_num(JSContext *ctx, JSFunctionBytecode *b,
     int new_line_num, line_num, pc, v, ret;
     unsigned int op;
 
-    if (!b->has_debug || !b->debug.pc2line_buf) {
+    if (!b->has_debug) {
         /* function was stripped */
         return -1;
     }
+    if (!b->debug.pc2line_buf) {
+        /* Patched: a function whose code all sits on its first line has no
+           pc2line table, yet still has debug info. Upstream reports no line
+           for it, leaving one-line functions (such as those created by
+           FunctionWithSource) unattributed in stack traces. */
+        return b->debug.line_num;
+    }
 
     p = b->debug.pc2line_buf;
     p_end = p + b->debug.pc2line_len;
@@ -6655,8 +6698,12 @@ JSValue JS_ThrowOutOfMemory(JSContext *ctx)
 {
     JSRuntime *rt = ctx->rt;
     if (!rt->in_out_of_memory) {
+        /* lift the memory limit so that the error object may be allocated */
+        size_t malloc_limit = rt->malloc_state.malloc_limit;
         rt->in_out_of_memory = TRUE;
+        rt->malloc_state.malloc_limit = -1;
         JS_ThrowInternalError(ctx, "out of memory");
+        rt->malloc_state.malloc_limit = malloc_limit;
         rt->in_out_of_memory = FALSE;
     }
     return JS_EXCEPTION;
@@ -6664,7 +6711,9 @@ JSValue JS_ThrowOutOfMemory(JSContext *ctx)
 
 static JSValue JS_ThrowStackOverflow(JSContext *ctx)
 {
-    return JS_ThrowInternalError(ctx, "stack overflow");
+    /* Patched: thrown as a RangeError rather than an InternalError, matching
+       other engines, such that scripts may catch it as they would elsewhere. */
+    return JS_ThrowRangeError(ctx, "stack overflow");
 }
 
 static JSValue JS_ThrowTypeErrorNotAnObject(JSContext *ctx)
@@ -8920,6 +8969,25 @@ static int js_update_property_flags(JSContext *ctx, JSObject *p,
     return 0;
 }
 
+/* Patched: remove a property of the global object even should it not be
+   configurable, as are those created by var and function declarations at
+   the top level of a script, such that bindings may be rolled back to a
+   snapshot of the global object. Returns -1 (exception) or TRUE. */
+int JS_DeleteGlobalBinding(JSContext *ctx, JSAtom prop)
+{
+    JSObject *p = JS_VALUE_GET_OBJ(ctx->global_obj);
+    JSShapeProperty *prs;
+    JSProperty *pr;
+
+    prs = find_own_property(&pr, p, prop);
+    if (!prs)
+        return TRUE;
+    if (js_update_property_flags(ctx, p, &prs,
+                                 prs->flags | JS_PROP_CONFIGURABLE))
+        return -1;
+    return delete_property(ctx, p, prop);
+}
+
 /* allowed flags:
    JS_PROP_CONFIGURABLE, JS_PROP_WRITABLE, JS_PROP_ENUMERABLE
    JS_PROP_HAS_GET, JS_PROP_HAS_SET, JS_PROP_HAS_VALUE,
@@ -9713,6 +9781,32 @@ void *JS_GetOpaque(JSValueConst obj, JSClassID class_id)
     return p->u.opaque;
 }
 
+/* Patched: expose the class of an object, such that bindings may check for
+   built-in classes without consulting prototypes that scripts may spoof.
+   Returns 0 should obj not be an object. */
+JSClassID JS_GetClassID(JSValueConst obj)
+{
+    if (JS_VALUE_GET_TAG(obj) != JS_TAG_OBJECT)
+        return 0;
+    return JS_VALUE_GET_OBJ(obj)->class_id;
+}
+
+const JSClassID JS_CLASS_ID_DATE = JS_CLASS_DATE;
+const JSClassID JS_CLASS_ID_REGEXP = JS_CLASS_REGEXP;
+const JSClassID JS_CLASS_ID_ARRAY_BUFFER = JS_CLASS_ARRAY_BUFFER;
+const JSClassID JS_CLASS_ID_SHARED_ARRAY_BUFFER = JS_CLASS_SHARED_ARRAY_BUFFER;
+const JSClassID JS_CLASS_ID_UINT8C_ARRAY = JS_CLASS_UINT8C_ARRAY;
+const JSClassID JS_CLASS_ID_INT8_ARRAY = JS_CLASS_INT8_ARRAY;
+const JSClassID JS_CLASS_ID_UINT8_ARRAY = JS_CLASS_UINT8_ARRAY;
+const JSClassID JS_CLASS_ID_INT16_ARRAY = JS_CLASS_INT16_ARRAY;
+const JSClassID JS_CLASS_ID_UINT16_ARRAY = JS_CLASS_UINT16_ARRAY;
+const JSClassID JS_CLASS_ID_INT32_ARRAY = JS_CLASS_INT32_ARRAY;
+const JSClassID JS_CLASS_ID_UINT32_ARRAY = JS_CLASS_UINT32_ARRAY;
+const JSClassID JS_CLASS_ID_BIG_INT64_ARRAY = JS_CLASS_BIG_INT64_ARRAY;
+const JSClassID JS_CLASS_ID_BIG_UINT64_ARRAY = JS_CLASS_BIG_UINT64_ARRAY;
+const JSClassID JS_CLASS_ID_FLOAT32_ARRAY = JS_CLASS_FLOAT32_ARRAY;
+const JSClassID JS_CLASS_ID_FLOAT64_ARRAY = JS_CLASS_FLOAT64_ARRAY;
+
 void *JS_GetOpaque2(JSContext *ctx, JSValueConst obj, JSClassID class_id)
 {
     void *p = JS_GetOpaque(obj, class_id);
@@ -16501,6 +16595,10 @@ static JSValue JS_CallInternal(JSContext *caller_ctx, JSValueConst func_obj,
                 int magic;
                 magic = get_u16(pc);
                 pc += 2;
+                /* Patched: record the pc as the other call opcodes do, such
+                   that a frame calling through spread arguments reports the
+                   line of the call rather than no line in stack traces. */
+                sf->cur_pc = pc;
 
                 ret_val = js_function_apply(ctx, sp[-3], 2, (JSValueConst *)&sp[-2], magic);
                 if (unlikely(JS_IsException(ret_val)))
@@ -27418,6 +27516,11 @@ static JSValue js_get_module_ns(JSContext *ctx, JSModuleDef *m)
     return JS_DupValue(ctx, m->module_ns);
 }
 
+JSValue JS_GetModuleNamespace(JSContext *ctx, JSModuleDef *m)
+{
+    return js_get_module_ns(ctx, m);
+}
+
 /* Load all the required modules for module 'm' */
 static int js_resolve_module(JSContext *ctx, JSModuleDef *m)
 {
@@ -37339,6 +37442,26 @@ static JSValue js_aggregate_error_constructor(JSContext *ctx,
     return obj;
 }
 
+/* Patched: construct an AggregateError from the intrinsic prototype, immune
+   to scripts reassigning the AggregateError global. */
+JSValue JS_NewAggregateError(JSContext *ctx, JSValueConst errors,
+                             const char *message, size_t len)
+{
+    JSValue obj, msg;
+
+    obj = js_aggregate_error_constructor(ctx, errors);
+    if (JS_IsException(obj))
+        return obj;
+    msg = JS_NewStringLen(ctx, message, len);
+    if (JS_IsException(msg)) {
+        JS_FreeValue(ctx, obj);
+        return msg;
+    }
+    JS_DefinePropertyValue(ctx, obj, JS_ATOM_message, msg,
+                           JS_PROP_WRITABLE | JS_PROP_CONFIGURABLE);
+    return obj;
+}
+
 /* Array */
 
 static int JS_CopySubArray(JSContext *ctx,
@@ -45588,12 +45711,6 @@ static const JSCFunctionListEntry js_generator_proto_funcs[] = {
 
 /* Promise */
 
-typedef enum JSPromiseStateEnum {
-    JS_PROMISE_PENDING,
-    JS_PROMISE_FULFILLED,
-    JS_PROMISE_REJECTED,
-} JSPromiseStateEnum;
-
 typedef struct JSPromiseData {
     JSPromiseStateEnum promise_state;
     /* 0=fulfill, 1=reject, list of JSPromiseReactionData.link */
@@ -46030,6 +46147,24 @@ JSValue JS_NewPromiseCapability(JSContext *ctx, JSValue *resolving_funcs)
     return js_new_promise_capability(ctx, resolving_funcs, JS_UNDEFINED);
 }
 
+/* return -1 if not a promise */
+JSPromiseStateEnum JS_PromiseState(JSContext *ctx, JSValueConst promise)
+{
+    JSPromiseData *s = JS_GetOpaque(promise, JS_CLASS_PROMISE);
+    if (!s)
+        return -1;
+    return s->promise_state;
+}
+
+/* return undefined if not a promise or if pending */
+JSValue JS_PromiseResult(JSContext *ctx, JSValueConst promise)
+{
+    JSPromiseData *s = JS_GetOpaque(promise, JS_CLASS_PROMISE);
+    if (!s)
+        return JS_UNDEFINED;
+    return JS_DupValue(ctx, s->promise_result);
+}
+
 static JSValue js_promise_resolve(JSContext *ctx, JSValueConst this_val,
                                   int argc, JSValueConst *argv, int magic)
 {
@@ -47618,6 +47753,19 @@ has_val:
     return rv;
 }
 
+/* Patched: create a Date holding the time value ms from the intrinsic
+   prototype, immune to scripts reassigning the Date global. */
+JSValue JS_NewDate(JSContext *ctx, double ms)
+{
+    JSValue obj;
+
+    obj = js_create_from_ctor(ctx, JS_UNDEFINED, JS_CLASS_DATE);
+    if (JS_IsException(obj))
+        return obj;
+    JS_SetObjectData(ctx, obj, JS_NewFloat64(ctx, time_clip(ms)));
+    return obj;
+}
+
 static JSValue js_Date_UTC(JSContext *ctx, JSValueConst this_val,
                            int argc, JSValueConst *argv)
 {
@@ -52420,6 +52568,16 @@ static JSValue js_typed_array_constructor(JSContext *ctx,
     return obj;
 }
 
+/* Patched: create a Uint8Array viewing the whole of buffer from the intrinsic
+   constructor, immune to scripts reassigning the Uint8Array global. */
+JSValue JS_NewUint8Array(JSContext *ctx, JSValueConst buffer)
+{
+    JSValueConst argv[3] = { buffer, JS_UNDEFINED, JS_UNDEFINED };
+
+    return js_typed_array_constructor(ctx, JS_UNDEFINED, 3, argv,
+                                      JS_CLASS_UINT8_ARRAY);
+}
+
 static void js_typed_array_finalizer(JSRuntime *rt, JSValue val)
 {
     JSObject *p = JS_VALUE_GET_OBJ(val);
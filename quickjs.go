@@ -1,12 +1,24 @@
 package quickjs
 
 import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
+	"io/ioutil"
+	"math"
 	"math/big"
+	"path/filepath"
+	"strings"
 	"sync"
 	"sync/atomic"
+	"time"
+	"unicode/utf8"
 	"unsafe"
 )
 
@@ -20,6 +32,8 @@ import (
 */
 import "C"
 
+const maxSafeInteger = 1<<53 - 1
+
 type Runtime struct {
 	ref *C.JSRuntime
 }
@@ -27,26 +41,419 @@ type Runtime struct {
 func NewRuntime() Runtime {
 	rt := Runtime{ref: C.JS_NewRuntime()}
 	C.JS_SetCanBlock(rt.ref, C.int(1))
+	C.NewFuncPtrClass(rt.ref, funcPtrClassID)
+	rt.state().owner = C.pthread_self()
 	return rt
 }
 
-func (r Runtime) RunGC() { C.JS_RunGC(r.ref) }
+func (r Runtime) RunGC() {
+	r.state().checkThread()
+	C.JS_RunGC(r.ref)
+}
+
+// RunFullGC repeatedly runs the garbage collector until a cycle no longer reduces the runtime's memory usage.
+func (r Runtime) RunFullGC() {
+	prev := r.MemoryUsage().MemoryUsedSize
+	for {
+		r.RunGC()
+
+		used := r.MemoryUsage().MemoryUsedSize
+		if used >= prev {
+			return
+		}
+		prev = used
+	}
+}
+
+// DefaultMaxStackSize is the maximum stack size in bytes that runtimes are created with.
+const DefaultMaxStackSize = C.JS_DEFAULT_STACK_SIZE
+
+// SetMaxStackSize sets the maximum size in bytes of the native stack that code may use, past which a RangeError is
+// thrown. The stack is measured on the OS thread the runtime is being used from, so size must stay well below the
+// stack size of OS threads (8MB by default on Linux) for the runtime to be safely used from any goroutine. A size of
+// zero disables the check, such that unbounded recursion overflows the stack of the OS thread and crashes the
+// process.
+func (r Runtime) SetMaxStackSize(size uint64) {
+	if size == 0 {
+		C.JS_SetMaxStackSize(r.ref, ^C.size_t(0))
+		return
+	}
+	C.JS_SetMaxStackSize(r.ref, C.size_t(size))
+}
+
+// SetErrorFormatter sets the function used to format errors thrown within the runtime into the messages returned by
+// Error.Error. Passing nil restores the default of returning just the cause of an error.
+func (r Runtime) SetErrorFormatter(fn ErrorFormatter) {
+	r.state().formatError = fn
+}
+
+// SetMaxFunctions limits the number of Go functions that may be registered through Context.Function across all
+// contexts of the runtime. Once the limit is reached, Context.Function returns a thrown RangeError. A limit of zero
+// removes the limit. Functions are no longer counted once they have been garbage collected.
+func (r Runtime) SetMaxFunctions(n int) {
+	r.state().maxFunctions = n
+}
+
+// SetMemoryLimit limits the amount of memory in bytes that the runtime and all of its contexts may allocate. Code
+// that allocates past the limit fails with an out of memory error. A limit of zero removes the limit.
+func (r Runtime) SetMemoryLimit(limit uint64) {
+	if limit == 0 {
+		C.JS_SetMemoryLimit(r.ref, ^C.size_t(0))
+		return
+	}
+	C.JS_SetMemoryLimit(r.ref, C.size_t(limit))
+}
+
+// MemoryUsage mirrors the memory usage statistics of a runtime reported by QuickJS. Sizes are in bytes. MallocLimit
+// is -1 should the runtime not have a memory limit.
+type MemoryUsage struct {
+	MallocSize, MallocLimit, MemoryUsedSize int64
+	MallocCount                             int64
+	MemoryUsedCount                         int64
+	AtomCount, AtomSize                     int64
+	StrCount, StrSize                       int64
+	ObjCount, ObjSize                       int64
+	PropCount, PropSize                     int64
+	ShapeCount, ShapeSize                   int64
+	JSFuncCount, JSFuncSize, JSFuncCodeSize int64
+	JSFuncPC2LineCount, JSFuncPC2LineSize   int64
+	CFuncCount, ArrayCount                  int64
+	FastArrayCount, FastArrayElements       int64
+	BinaryObjectCount, BinaryObjectSize     int64
+}
+
+// MemoryUsage computes the memory usage statistics of the runtime.
+func (r Runtime) MemoryUsage() MemoryUsage {
+	var usage C.JSMemoryUsage
+	C.JS_ComputeMemoryUsage(r.ref, &usage)
+
+	return MemoryUsage{
+		MallocSize:         int64(usage.malloc_size),
+		MallocLimit:        int64(usage.malloc_limit),
+		MemoryUsedSize:     int64(usage.memory_used_size),
+		MallocCount:        int64(usage.malloc_count),
+		MemoryUsedCount:    int64(usage.memory_used_count),
+		AtomCount:          int64(usage.atom_count),
+		AtomSize:           int64(usage.atom_size),
+		StrCount:           int64(usage.str_count),
+		StrSize:            int64(usage.str_size),
+		ObjCount:           int64(usage.obj_count),
+		ObjSize:            int64(usage.obj_size),
+		PropCount:          int64(usage.prop_count),
+		PropSize:           int64(usage.prop_size),
+		ShapeCount:         int64(usage.shape_count),
+		ShapeSize:          int64(usage.shape_size),
+		JSFuncCount:        int64(usage.js_func_count),
+		JSFuncSize:         int64(usage.js_func_size),
+		JSFuncCodeSize:     int64(usage.js_func_code_size),
+		JSFuncPC2LineCount: int64(usage.js_func_pc2line_count),
+		JSFuncPC2LineSize:  int64(usage.js_func_pc2line_size),
+		CFuncCount:         int64(usage.c_func_count),
+		ArrayCount:         int64(usage.array_count),
+		FastArrayCount:     int64(usage.fast_array_count),
+		FastArrayElements:  int64(usage.fast_array_elements),
+		BinaryObjectCount:  int64(usage.binary_object_count),
+		BinaryObjectSize:   int64(usage.binary_object_size),
+	}
+}
+
+// SetThreadCheck sets whether or not to panic should the runtime, or any of its contexts or values, be used from an
+// OS thread other than the one the runtime was created on. It should only be enabled should the goroutine that
+// created the runtime be locked to its OS thread via runtime.LockOSThread. The check is a debugging aid rather than
+// a guarantee: it covers evaluating code, calling functions and constructors, getting and setting properties by
+// name, converting values into strings, parsing JSON, running the garbage collector or pending jobs, and freeing
+// contexts and values. Other methods are not checked.
+func (r Runtime) SetThreadCheck(enabled bool) {
+	check := int32(0)
+	if enabled {
+		check = 1
+	}
+	atomic.StoreInt32(&r.state().threadCheck, check)
+}
+
+func (r Runtime) Free() {
+	C.JS_FreeRuntime(r.ref)
+	freeRuntimeState(r.ref)
+}
+
+type runtimeState struct {
+	owner       C.pthread_t
+	threadCheck int32
+
+	resolveModule func(moduleName, baseName string) string
+	loadModule    func(moduleName string) ([]byte, error)
+
+	interruptible bool
+	interrupt     func() bool
+	interrupted   *InterruptedError
+	deadline      time.Time
+	goctxs        []context.Context
+
+	contexts      map[*C.JSContext]*Context
+	nativeModules map[string]func(ctx *Context) map[string]Value
+
+	formatError ErrorFormatter
+
+	functions    int
+	maxFunctions int
+
+	importing int
+}
+
+var runtimeStateLock sync.Mutex
+var runtimeStateStore = make(map[*C.JSRuntime]*runtimeState)
+
+func (r Runtime) state() *runtimeState { return restoreRuntimeState(r.ref) }
+
+func restoreRuntimeState(ref *C.JSRuntime) *runtimeState {
+	runtimeStateLock.Lock()
+	defer runtimeStateLock.Unlock()
+
+	state, exists := runtimeStateStore[ref]
+	if !exists {
+		state = &runtimeState{}
+		runtimeStateStore[ref] = state
+	}
+	return state
+}
+
+func (s *runtimeState) checkThread() {
+	if atomic.LoadInt32(&s.threadCheck) == 1 && C.pthread_equal(s.owner, C.pthread_self()) == 0 {
+		panic("quickjs: runtime used from an os thread other than the one it was created on")
+	}
+}
+
+func (s *runtimeState) track(ctx *Context) *Context {
+	if s.contexts == nil {
+		s.contexts = make(map[*C.JSContext]*Context)
+	}
+	s.contexts[ctx.ref] = ctx
+	return ctx
+}
+
+func (s *runtimeState) updateModuleLoader(rt *C.JSRuntime) {
+	if s.loadModule == nil && len(s.nativeModules) == 0 && s.importing == 0 {
+		C.JS_SetModuleLoaderFunc(rt, nil, nil, nil)
+		return
+	}
+
+	normalize := 0
+	if s.resolveModule != nil {
+		normalize = 1
+	}
+	C.SetModuleLoaderFunc(rt, C.int(normalize))
+}
+
+func freeRuntimeState(ref *C.JSRuntime) {
+	runtimeStateLock.Lock()
+	defer runtimeStateLock.Unlock()
+	delete(runtimeStateStore, ref)
+}
+
+// SetModuleLoader sets the functions used to resolve and load modules imported by the runtime, either statically
+// or through a dynamic import(). resolve maps a module specifier imported from the module named baseName into a
+// canonical module name, and may be nil to resolve specifiers relative to baseName. load returns the source code of
+// the module with the given canonical name. Passing a nil load disables module loading. Errors returned by load, and
+// panics within either function, are thrown as a ReferenceError from the import that triggered the load.
+func (r Runtime) SetModuleLoader(resolve func(moduleName, baseName string) string, load func(moduleName string) ([]byte, error)) {
+	state := r.state()
+	state.resolveModule = resolve
+	state.loadModule = load
+	state.updateModuleLoader(r.ref)
+}
+
+// RegisterNativeModule registers a module with the given name whose exports are provided by Go. exports is called
+// the first time the module is imported by a context, and the module takes ownership of the values it returns.
+// Native modules take precedence over modules provided by the loader set via SetModuleLoader.
+func (r Runtime) RegisterNativeModule(name string, exports func(ctx *Context) map[string]Value) {
+	state := r.state()
+	if state.nativeModules == nil {
+		state.nativeModules = make(map[string]func(ctx *Context) map[string]Value)
+	}
+	state.nativeModules[name] = exports
+	state.updateModuleLoader(r.ref)
+}
+
+// InterruptedError is returned when evaluation is aborted by an interrupt handler or a deadline. Cause is
+// context.DeadlineExceeded should evaluation have run past its deadline.
+type InterruptedError struct {
+	Cause error
+}
+
+func (err *InterruptedError) Error() string {
+	if err.Cause != nil {
+		return "interrupted: " + err.Cause.Error()
+	}
+	return "interrupted"
+}
+
+func (err *InterruptedError) Unwrap() error { return err.Cause }
+
+// SetInterruptHandler sets a function that is called periodically while code is being evaluated, on the same OS
+// thread evaluating the code. Evaluation is aborted with an InterruptedError should fn return true. Passing nil
+// removes the handler.
+func (r Runtime) SetInterruptHandler(fn func() bool) {
+	state := r.state()
+	state.interrupt = fn
+	state.enableInterrupts(r.ref)
+}
+
+func (s *runtimeState) enableInterrupts(rt *C.JSRuntime) {
+	if !s.interruptible {
+		C.SetInterruptHandler(rt)
+		s.interruptible = true
+	}
+}
+
+//export interruptHandler
+func interruptHandler(rt *C.JSRuntime) C.int {
+	state := restoreRuntimeState(rt)
+	if !state.deadline.IsZero() && time.Now().After(state.deadline) {
+		state.interrupted = &InterruptedError{Cause: context.DeadlineExceeded}
+		return 1
+	}
+	for _, goctx := range state.goctxs {
+		if err := goctx.Err(); err != nil {
+			state.interrupted = &InterruptedError{Cause: err}
+			return 1
+		}
+	}
+	if state.interrupt != nil && state.interrupt() {
+		state.interrupted = &InterruptedError{}
+		return 1
+	}
+	return 0
+}
+
+//export normalizeModule
+func normalizeModule(ctx *C.JSContext, baseName *C.char, moduleName *C.char) *C.char {
+	state := restoreRuntimeState(C.JS_GetRuntime(ctx))
+
+	var name string
+	err := recoverModuleHook(func() error {
+		name = state.resolveModule(C.GoString(moduleName), C.GoString(baseName))
+		return nil
+	})
+	if err != nil {
+		causePtr := C.CString(fmt.Sprintf("could not resolve module '%s': %s", C.GoString(moduleName), err))
+		defer C.free(unsafe.Pointer(causePtr))
+		C.ThrowReferenceError(ctx, causePtr)
+		return nil
+	}
+
+	namePtr := C.CString(name)
+	defer C.free(unsafe.Pointer(namePtr))
+
+	return C.js_strdup(ctx, namePtr)
+}
+
+// recoverModuleHook calls fn, converting a panic into an error rather than letting it unwind through the C frames
+// of the engine loading a module.
+func recoverModuleHook(fn func() error) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("panic: %v", r)
+		}
+	}()
+	return fn()
+}
+
+//export loadModule
+func loadModule(ctx *C.JSContext, moduleName *C.char) *C.JSModuleDef {
+	state := restoreRuntimeState(C.JS_GetRuntime(ctx))
+
+	if val, exists := state.contexts[ctx].imports[C.GoString(moduleName)]; exists {
+		context := state.contexts[ctx]
+		if context.provided == nil {
+			context.provided = make(map[string]Value)
+		}
+		context.provided[C.GoString(moduleName)] = val.Dup()
+		return context.nativeModule(moduleName, val.moduleExports)
+	}
+
+	if exports, exists := state.nativeModules[C.GoString(moduleName)]; exists {
+		return state.contexts[ctx].nativeModule(moduleName, exports)
+	}
+
+	var code []byte
+	err := errors.New("no module loader set")
+	if state.loadModule != nil {
+		err = recoverModuleHook(func() (err error) {
+			code, err = state.loadModule(C.GoString(moduleName))
+			return err
+		})
+	}
+	if err != nil {
+		causePtr := C.CString(fmt.Sprintf("could not load module '%s': %s", C.GoString(moduleName), err))
+		defer C.free(unsafe.Pointer(causePtr))
+		C.ThrowReferenceError(ctx, causePtr)
+		return nil
+	}
+
+	codePtr := C.CString(string(code))
+	defer C.free(unsafe.Pointer(codePtr))
+
+	return C.CompileModule(ctx, moduleName, codePtr, C.size_t(len(code)))
+}
+
+//export initModule
+func initModule(ctx *C.JSContext, m *C.JSModuleDef) C.int {
+	context := restoreRuntimeState(C.JS_GetRuntime(ctx)).contexts[ctx]
+
+	exports := context.nativeExports[m]
+	delete(context.nativeExports, m)
+
+	result := C.int(0)
+	for name, val := range exports {
+		namePtr := C.CString(name)
+		if C.JS_SetModuleExport(ctx, m, namePtr, val.ref) < 0 {
+			result = -1
+		}
+		C.free(unsafe.Pointer(namePtr))
+	}
+	return result
+}
+
+func (ctx *Context) nativeModule(moduleName *C.char, exports func(ctx *Context) map[string]Value) *C.JSModuleDef {
+	m := C.NewCModule(ctx.ref, moduleName)
+	if m == nil {
+		return nil
+	}
+
+	values := exports(ctx)
+	for name := range values {
+		namePtr := C.CString(name)
+		C.JS_AddModuleExport(ctx.ref, m, namePtr)
+		C.free(unsafe.Pointer(namePtr))
+	}
+
+	if ctx.nativeExports == nil {
+		ctx.nativeExports = make(map[*C.JSModuleDef]map[string]Value)
+	}
+	ctx.nativeExports[m] = values
 
-func (r Runtime) Free() { C.JS_FreeRuntime(r.ref) }
+	return m
+}
 
 func (r Runtime) NewContext() *Context {
-	ref := C.JS_NewContext(r.ref)
+	state := r.state()
+	return state.track(&Context{ref: newContext(r.ref), runtime: state})
+}
+
+func newContext(rt *C.JSRuntime) *C.JSContext {
+	ref := C.JS_NewContext(rt)
 
 	C.JS_AddIntrinsicBigFloat(ref)
 	C.JS_AddIntrinsicBigDecimal(ref)
 	C.JS_AddIntrinsicOperators(ref)
 	C.JS_EnableBignumExt(ref, C.int(1))
 
-	return &Context{ref: ref}
+	return ref
 }
 
 func (r Runtime) ExecutePendingJob() (Context, error) {
-	var ctx Context
+	ctx := Context{runtime: r.state()}
+	ctx.runtime.checkThread()
 
 	err := C.JS_ExecutePendingJob(r.ref, &ctx.ref)
 	if err <= 0 {
@@ -59,6 +466,21 @@ func (r Runtime) ExecutePendingJob() (Context, error) {
 	return ctx, nil
 }
 
+// ExecuteAllPendingJobs executes pending jobs until none are left, including jobs enqueued by the jobs executed. It
+// returns the error of the first job that failed, if any.
+func (r Runtime) ExecuteAllPendingJobs() error {
+	var first error
+	for {
+		_, err := r.ExecutePendingJob()
+		if err == io.EOF {
+			return first
+		}
+		if err != nil && first == nil {
+			first = err
+		}
+	}
+}
+
 type Function func(ctx *Context, this Value, args []Value) Value
 
 type funcEntry struct {
@@ -87,20 +509,38 @@ func restoreFuncPtr(ptr int64) funcEntry {
 	return funcPtrStore[ptr]
 }
 
-//func freeFuncPtr(ptr int64) {
-//	funcPtrLock.Lock()
-//	defer funcPtrLock.Unlock()
-//	delete(funcPtrStore, ptr)
-//}
+func freeFuncPtr(ptr int64) {
+	funcPtrLock.Lock()
+	defer funcPtrLock.Unlock()
+
+	if entry, exists := funcPtrStore[ptr]; exists {
+		entry.ctx.runtime.functions--
+		delete(funcPtrStore, ptr)
+	}
+}
+
+// finalizeFuncPtr frees the function stored under the id held by val, once the JS function wrapping it, which is
+// the only holder of val, has been garbage collected.
+//
+//export finalizeFuncPtr
+func finalizeFuncPtr(rt *C.JSRuntime, val C.JSValue) {
+	freeFuncPtr(int64(C.GetFuncPtr(val, funcPtrClassID)))
+}
 
+// proxy invokes the Go function registered through Context.Function. Panics within the function are recovered and
+// thrown as a JS Error rather than unwinding through the C frames of the engine.
+//
 //export proxy
-func proxy(ctx *C.JSContext, thisVal C.JSValueConst, argc C.int, argv *C.JSValueConst) C.JSValue {
+func proxy(ctx *C.JSContext, thisVal C.JSValueConst, argc C.int, argv *C.JSValueConst) (result C.JSValue) {
 	refs := (*[1 << 30]C.JSValueConst)(unsafe.Pointer(argv))[:argc:argc]
 
-	id := C.int64_t(0)
-	C.JS_ToInt64(ctx, &id, refs[0])
+	entry := restoreFuncPtr(int64(C.GetFuncPtr(refs[0], funcPtrClassID)))
 
-	entry := restoreFuncPtr(int64(id))
+	defer func() {
+		if r := recover(); r != nil {
+			result = entry.ctx.ThrowError(fmt.Errorf("panic: %v", r)).ref
+		}
+	}()
 
 	args := make([]Value, len(refs)-1)
 	for i := 0; i < len(args); i++ {
@@ -108,37 +548,201 @@ func proxy(ctx *C.JSContext, thisVal C.JSValueConst, argc C.int, argv *C.JSValue
 		args[i].ref = refs[1+i]
 	}
 
-	result := entry.fn(entry.ctx, Value{ctx: entry.ctx, ref: thisVal}, args)
-
-	return result.ref
+	return entry.fn(entry.ctx, Value{ctx: entry.ctx, ref: thisVal}, args).ref
 }
 
 type Context struct {
-	ref     *C.JSContext
-	globals *Value
-	proxy   *Value
+	ref       *C.JSContext
+	runtime   *runtimeState
+	globals   *Value
+	proxy     *Value
+	natives   *Value
+	transform func(code, filename string) (string, error)
+	deadline  time.Time
+	timers    *timerState
+	profile   map[string]int64
+
+	nativeExports map[*C.JSModuleDef]map[string]Value
+	imports       map[string]Value
+	provided      map[string]Value
+	capabilities  map[*promiseCapability]struct{}
+	operators     []Value
+	recorded      []recordedGlobal
+	realms        []*Context
+	parent        *Context
+}
+
+type recordedGlobal struct {
+	name string
+	val  Value
+	fn   Function
 }
 
 func (ctx *Context) Free() {
+	ctx.runtime.checkThread()
+
 	if ctx.proxy != nil {
 		ctx.proxy.Free()
 	}
 	if ctx.globals != nil {
 		ctx.globals.Free()
 	}
+	if ctx.natives != nil {
+		ctx.natives.Free()
+	}
+	if ctx.timers != nil {
+		ctx.timers.fire.Free()
+	}
+	for _, exports := range ctx.nativeExports {
+		for _, val := range exports {
+			val.Free()
+		}
+	}
+	for _, global := range ctx.recorded {
+		if global.fn == nil {
+			global.val.Free()
+		}
+	}
+	for capability := range ctx.capabilities {
+		capability.free(ctx)
+	}
+	for _, op := range ctx.operators {
+		op.Free()
+	}
+	for _, val := range ctx.provided {
+		val.Free()
+	}
+	for _, realm := range ctx.realms {
+		realm.parent = nil
+		realm.Free()
+	}
+	if ctx.parent != nil {
+		for i, realm := range ctx.parent.realms {
+			if realm == ctx {
+				ctx.parent.realms = append(ctx.parent.realms[:i:i], ctx.parent.realms[i+1:]...)
+				break
+			}
+		}
+	}
+
+	delete(ctx.runtime.contexts, ctx.ref)
 
 	C.JS_FreeContext(ctx.ref)
 }
 
+// SetGlobal sets the global with the given name to val, taking ownership of val. The global is recorded such that
+// it is set on contexts created through Clone.
+func (ctx *Context) SetGlobal(name string, val Value) {
+	ctx.Globals().Set(name, val.Dup())
+	ctx.recorded = append(ctx.recorded, recordedGlobal{name: name, val: val})
+}
+
+// SetGlobalFunction sets the global with the given name to a function calling fn. The function is recorded such
+// that it is set on contexts created through Clone.
+func (ctx *Context) SetGlobalFunction(name string, fn Function) {
+	ctx.Globals().SetFunction(name, fn)
+	ctx.recorded = append(ctx.recorded, recordedGlobal{name: name, fn: fn})
+}
+
+// Clone creates a new context within the same runtime, replaying onto it all globals and functions set through
+// SetGlobal and SetGlobalFunction along with the source transform and deadline of ctx. Values set through SetGlobal
+// are shared by reference between ctx and its clones rather than deep-copied, and any other state of ctx is not
+// carried over.
+func (ctx *Context) Clone() (*Context, error) {
+	ref := newContext(C.JS_GetRuntime(ctx.ref))
+	if ref == nil {
+		return nil, errors.New("could not create context")
+	}
+
+	clone := ctx.runtime.track(&Context{ref: ref, runtime: ctx.runtime, transform: ctx.transform, deadline: ctx.deadline})
+	for _, global := range ctx.recorded {
+		if global.fn != nil {
+			clone.SetGlobalFunction(global.name, global.fn)
+			continue
+		}
+		clone.SetGlobal(global.name, Value{ctx: clone, ref: C.JS_DupValue(clone.ref, global.val.ref)})
+	}
+	return clone, nil
+}
+
 func (ctx *Context) Function(fn Function) Value {
-	val := ctx.eval(`(proxy, id) => function() { return proxy.call(this, id, ...arguments); }`)
+	return ctx.function(ctx.eval(`(proxy, id, natives) => {
+		const fn = function() { return proxy.call(this, id, ...arguments); };
+		natives.add(fn);
+		return fn;
+	}`), fn)
+}
+
+// FunctionWithError is like Function, though fn returns an error alongside its result. Should fn return a non-nil
+// error, its result is freed and the error is thrown as a JS Error with the error's message.
+func (ctx *Context) FunctionWithError(fn func(ctx *Context, this Value, args []Value) (Value, error)) Value {
+	return ctx.Function(func(ctx *Context, this Value, args []Value) Value {
+		val, err := fn(ctx, this, args)
+		if err != nil {
+			if val.ctx != nil {
+				val.Free()
+			}
+			return ctx.ThrowError(err)
+		}
+		return val
+	})
+}
+
+// maxSourceLine is the largest line FunctionWithSource attributes functions to. The line is reached by padding
+// the source of the function with newlines, so that it is capped to bound the cost of doing so.
+const maxSourceLine = 1 << 16
+
+// FunctionWithSource is like Function, though the returned function is named name and attributed to the given
+// filename and line (starting from 1) in stack traces. A RangeError is thrown should line exceed 65536.
+func (ctx *Context) FunctionWithSource(name, filename string, line int, fn Function) Value {
+	if line < 1 {
+		line = 1
+	}
+	if line > maxSourceLine {
+		return ctx.ThrowRangeError("line %d exceeds %d", line, maxSourceLine)
+	}
+
+	nameVal := ctx.String(name)
+	defer nameVal.Free()
+
+	code := strings.Repeat("\n", line-1) +
+		`(name) => (proxy, id, natives) => { const fn = { [name]: function() { return proxy.call(this, id, ...arguments); } }[name]; natives.add(fn); return fn; }`
+
+	factory := ctx.evalFile(code, filename, 0)
+	if factory.IsException() {
+		return factory
+	}
+	defer factory.Free()
+
+	return ctx.function(ctx.call(factory, ctx.Null(), nameVal), fn)
+}
+
+func (ctx *Context) function(val Value, fn Function) Value {
 	if val.IsException() {
 		return val
 	}
 	defer val.Free()
 
+	if max := ctx.runtime.maxFunctions; max > 0 && ctx.runtime.functions >= max {
+		return ctx.ThrowRangeError("too many functions registered (max %d)", max)
+	}
+	ctx.runtime.functions++
+
+	if ctx.natives == nil {
+		natives := ctx.eval(`new WeakSet()`)
+		if natives.IsException() {
+			return natives
+		}
+		ctx.natives = &natives
+	}
+
 	funcPtr := storeFuncPtr(funcEntry{ctx: ctx, fn: fn})
-	funcPtrVal := ctx.Int64(funcPtr)
+	funcPtrVal := Value{ctx: ctx, ref: C.NewFuncPtr(ctx.ref, funcPtrClassID, C.int64_t(funcPtr))}
+	if funcPtrVal.IsException() {
+		freeFuncPtr(funcPtr)
+		return funcPtrVal
+	}
+	defer funcPtrVal.Free()
 
 	if ctx.proxy == nil {
 		ctx.proxy = &Value{
@@ -147,237 +751,2103 @@ func (ctx *Context) Function(fn Function) Value {
 		}
 	}
 
-	args := []C.JSValue{ctx.proxy.ref, funcPtrVal.ref}
+	args := []C.JSValue{ctx.proxy.ref, funcPtrVal.ref, ctx.natives.ref}
+
+	defer ctx.enter()()
 
 	return Value{ctx: ctx, ref: C.JS_Call(ctx.ref, val.ref, ctx.Null().ref, C.int(len(args)), &args[0])}
 }
 
-func (ctx *Context) Null() Value {
-	return Value{ctx: ctx, ref: C.JS_NewNull()}
+// AsyncIterableFromChannel returns a JS async iterable that yields each value received from ch, and completes
+// once ch is closed. Receiving from ch blocks the runtime, and values sent over ch must belong to ctx.
+func (ctx *Context) AsyncIterableFromChannel(ch <-chan Value) Value {
+	val := ctx.eval(`(next) => ({ [Symbol.asyncIterator]() { return { next: async () => next() }; } })`)
+	if val.IsException() {
+		return val
+	}
+	defer val.Free()
+
+	next := ctx.Function(func(ctx *Context, this Value, args []Value) Value {
+		result := ctx.Object()
+
+		item, ok := <-ch
+		if !ok {
+			result.Set("value", ctx.Undefined())
+			result.Set("done", ctx.Bool(true))
+			return result
+		}
+
+		result.Set("value", item)
+		result.Set("done", ctx.Bool(false))
+		return result
+	})
+	if next.IsException() {
+		return next
+	}
+	defer next.Free()
+
+	return ctx.call(val, ctx.Null(), next)
 }
 
-func (ctx *Context) Undefined() Value {
-	return Value{ctx: ctx, ref: C.JS_NewUndefined()}
+// ErrGeneratorClosed is returned by the yield function of an async generator once iteration has stopped early, e.g.
+// by a for await loop being broken out of.
+var ErrGeneratorClosed = errors.New("async generator was closed")
+
+type generatorStep struct {
+	val  func(ctx *Context) Value
+	done bool
+	err  error
 }
 
-func (ctx *Context) Uninitialized() Value {
-	return Value{ctx: ctx, ref: C.JS_NewUninitialized()}
+// AsyncGenerator returns a JS async iterable driven by fn, which yields a value for each function it passes to
+// yield. The iterable completes once fn returns, or is rejected with the error fn returns, or with an error should
+// fn panic. fn runs on its own goroutine, though never concurrently with the runtime, as each yield hands control
+// back to the iterating code until the next value is requested. As the runtime must not be used from fn, the
+// functions passed to yield are instead called on the goroutine iterating to create the values yielded. The
+// goroutine leaks should iteration neither complete nor be stopped.
+func (ctx *Context) AsyncGenerator(fn func(yield func(func(ctx *Context) Value) error) error) Value {
+	val := ctx.eval(`(next, stop) => ({
+		[Symbol.asyncIterator]() { return this; },
+		next: async () => next(),
+		return: async (value) => { stop(); return { value, done: true }; },
+	})`)
+	if val.IsException() {
+		return val
+	}
+	defer val.Free()
+
+	var (
+		started, finished, closed bool
+
+		resume = make(chan struct{})
+		steps  = make(chan generatorStep)
+	)
+
+	yield := func(val func(ctx *Context) Value) error {
+		if closed {
+			return ErrGeneratorClosed
+		}
+		steps <- generatorStep{val: val}
+		<-resume
+		if closed {
+			return ErrGeneratorClosed
+		}
+		return nil
+	}
+
+	step := func() generatorStep {
+		if !started {
+			started = true
+			go func() {
+				var err error
+				defer func() {
+					if r := recover(); r != nil {
+						err = fmt.Errorf("async generator panicked: %v", r)
+					}
+					steps <- generatorStep{done: true, err: err}
+				}()
+				err = fn(yield)
+			}()
+		} else {
+			resume <- struct{}{}
+		}
+
+		step := <-steps
+		finished = step.done
+		return step
+	}
+
+	next := ctx.Function(func(ctx *Context, this Value, args []Value) Value {
+		result := ctx.Object()
+		if finished {
+			result.Set("done", ctx.Bool(true))
+			return result
+		}
+
+		step := step()
+		if step.err != nil {
+			result.Free()
+			return ctx.ThrowError(step.err)
+		}
+
+		if step.done {
+			result.Set("done", ctx.Bool(true))
+			return result
+		}
+		result.Set("value", step.val(ctx))
+		result.Set("done", ctx.Bool(false))
+		return result
+	})
+	defer next.Free()
+
+	stop := ctx.Function(func(ctx *Context, this Value, args []Value) Value {
+		if started && !finished {
+			closed = true
+			close(resume)
+			<-steps
+			finished = true
+		}
+		return ctx.Undefined()
+	})
+	defer stop.Free()
+
+	return ctx.call(val, ctx.Null(), next, stop)
 }
 
-func (ctx *Context) Error(err error) Value {
-	val := Value{ctx: ctx, ref: C.JS_NewError(ctx.ref)}
-	val.Set("message", ctx.String(err.Error()))
-	return val
+// SetDeadline sets a deadline past which any code evaluated or function called through the context is interrupted,
+// failing with an InterruptedError caused by context.DeadlineExceeded. A zero deadline removes it.
+func (ctx *Context) SetDeadline(deadline time.Time) {
+	ctx.deadline = deadline
+	if !deadline.IsZero() {
+		ctx.runtime.enableInterrupts(C.JS_GetRuntime(ctx.ref))
+	}
 }
 
-func (ctx *Context) Bool(b bool) Value {
-	bv := 0
-	if b {
-		bv = 1
+// enter arms the runtime with the deadline of the context for the duration of a call into the interpreter. It
+// returns a function restoring the deadline of any enclosing call.
+func (ctx *Context) enter() func() {
+	state := ctx.runtime
+	prev := state.deadline
+	if !ctx.deadline.IsZero() && (prev.IsZero() || ctx.deadline.Before(prev)) {
+		state.deadline = ctx.deadline
 	}
-	return Value{ctx: ctx, ref: C.JS_NewBool(ctx.ref, C.int(bv))}
+	return func() { state.deadline = prev }
 }
 
-func (ctx *Context) Int32(v int32) Value {
-	return Value{ctx: ctx, ref: C.JS_NewInt32(ctx.ref, C.int32_t(v))}
+// Call calls the function v with this bound to this, returning the error thrown should the call throw. this may be
+// undefined, and args may be empty. args remain owned by the caller, and the returned value must be freed. The
+// thrown exception is cleared once it is returned, so that v may safely be called again should the call throw.
+func (v Value) Call(this Value, args ...Value) (Value, error) {
+	val := v.ctx.call(v, this, args...)
+	if val.IsException() {
+		return val, v.ctx.Exception()
+	}
+	return val, nil
 }
 
-func (ctx *Context) Int64(v int64) Value {
-	return Value{ctx: ctx, ref: C.JS_NewInt64(ctx.ref, C.int64_t(v))}
+// NewPromise returns a pending promise alongside functions resolving or rejecting it. Only the first call to either
+// function has any effect; both take ownership of the value passed to them. As with all use of the runtime, they
+// must be called from the goroutine using the runtime, e.g. once the result of a goroutine was received over a
+// channel. The resolving functions are held until either function is called; should neither ever be called, they
+// are released once ctx is freed, after which calling either function has no effect beyond freeing its value.
+func (ctx *Context) NewPromise() (promise Value, resolve func(Value), reject func(Value)) {
+	capability := &promiseCapability{}
+
+	promise = Value{ctx: ctx, ref: C.JS_NewPromiseCapability(ctx.ref, &capability.funcs[0])}
+	if promise.IsException() {
+		return promise, func(val Value) { val.Free() }, func(val Value) { val.Free() }
+	}
+
+	if ctx.capabilities == nil {
+		ctx.capabilities = make(map[*promiseCapability]struct{})
+	}
+	ctx.capabilities[capability] = struct{}{}
+
+	var once sync.Once
+	settle := func(idx int, val Value) {
+		defer val.Free()
+		once.Do(func() {
+			if _, pending := ctx.capabilities[capability]; !pending {
+				return
+			}
+
+			result := ctx.call(Value{ctx: ctx, ref: capability.funcs[idx]}, ctx.Undefined(), val)
+			result.Free()
+
+			capability.free(ctx)
+		})
+	}
+
+	resolve = func(val Value) { settle(0, val) }
+	reject = func(val Value) { settle(1, val) }
+
+	return promise, resolve, reject
 }
 
-func (ctx *Context) Uint32(v uint32) Value {
-	return Value{ctx: ctx, ref: C.JS_NewUint32(ctx.ref, C.uint32_t(v))}
+// promiseCapability holds the resolving functions of a promise created through NewPromise until either is called,
+// or until the context is freed.
+type promiseCapability struct {
+	funcs [2]C.JSValue
 }
 
-func (ctx *Context) BigUint64(v uint64) Value {
-	return Value{ctx: ctx, ref: C.JS_NewBigUint64(ctx.ref, C.uint64_t(v))}
+func (c *promiseCapability) free(ctx *Context) {
+	delete(ctx.capabilities, c)
+	C.JS_FreeValue(ctx.ref, c.funcs[0])
+	C.JS_FreeValue(ctx.ref, c.funcs[1])
+}
+
+// Tags of values as reported by Value.Tag, mirroring the JS_TAG_* constants of QuickJS.
+const (
+	TagBigDecimal       = int(C.JS_TAG_BIG_DECIMAL)
+	TagBigInt           = int(C.JS_TAG_BIG_INT)
+	TagBigFloat         = int(C.JS_TAG_BIG_FLOAT)
+	TagSymbol           = int(C.JS_TAG_SYMBOL)
+	TagString           = int(C.JS_TAG_STRING)
+	TagModule           = int(C.JS_TAG_MODULE)
+	TagFunctionBytecode = int(C.JS_TAG_FUNCTION_BYTECODE)
+	TagObject           = int(C.JS_TAG_OBJECT)
+	TagInt              = int(C.JS_TAG_INT)
+	TagBool             = int(C.JS_TAG_BOOL)
+	TagNull             = int(C.JS_TAG_NULL)
+	TagUndefined        = int(C.JS_TAG_UNDEFINED)
+	TagUninitialized    = int(C.JS_TAG_UNINITIALIZED)
+	TagCatchOffset      = int(C.JS_TAG_CATCH_OFFSET)
+	TagException        = int(C.JS_TAG_EXCEPTION)
+	TagFloat64          = int(C.JS_TAG_FLOAT64)
+)
+
+// Tag returns the internal QuickJS tag of v, one of the Tag* constants. It is intended for debugging; use the Is*
+// methods to check the type of a value.
+func (v Value) Tag() int { return int(C.ValueGetTag(v.ref)) }
+
+// PromiseState is the state of a promise.
+type PromiseState int
+
+const (
+	PromisePending PromiseState = iota
+	PromiseFulfilled
+	PromiseRejected
+)
+
+func (s PromiseState) String() string {
+	switch s {
+	case PromisePending:
+		return "pending"
+	case PromiseFulfilled:
+		return "fulfilled"
+	case PromiseRejected:
+		return "rejected"
+	}
+	return "invalid"
+}
+
+func (v Value) IsPromise() bool { return v.PromiseState() >= 0 }
+
+// PromiseState returns the state of the promise v without waiting for it to settle. The state returned should v
+// not be a promise is invalid.
+func (v Value) PromiseState() PromiseState {
+	return PromiseState(int32(C.JS_PromiseState(v.ctx.ref, v.ref)))
+}
+
+// PromiseResult returns the value the promise v fulfilled or was rejected with, or undefined should v be pending or
+// not be a promise.
+func (v Value) PromiseResult() Value {
+	return Value{ctx: v.ctx, ref: C.JS_PromiseResult(v.ctx.ref, v.ref)}
+}
+
+// Await executes pending jobs until the promise or thenable v settles, returning the value it fulfilled with or an
+// error built from the reason it was rejected with. An error is returned should v not be a thenable, or should v
+// not have settled once no jobs are left pending.
+func (v Value) Await() (Value, error) {
+	if !v.IsObject() {
+		return v.ctx.Undefined(), errors.New("value is not a thenable")
+	}
+
+	then := v.Get("then")
+	if then.IsException() {
+		return v.ctx.Undefined(), v.ctx.Exception()
+	}
+	defer then.Free()
+
+	if !then.IsFunction() {
+		return v.ctx.Undefined(), errors.New("value is not a thenable")
+	}
+
+	track := v.ctx.eval(`(promise, then) => {
+		const state = { settled: false };
+		new Promise((resolve, reject) => then.call(promise, resolve, reject)).then(
+			(value) => Object.assign(state, { settled: true, fulfilled: true, value }),
+			(value) => Object.assign(state, { settled: true, fulfilled: false, value }),
+		);
+		return state;
+	}`)
+	if track.IsException() {
+		return track, v.ctx.Exception()
+	}
+	defer track.Free()
+
+	state, err := track.Call(v.ctx.Null(), v, then)
+	if err != nil {
+		return state, err
+	}
+	defer state.Free()
+
+	rt := Runtime{ref: C.JS_GetRuntime(v.ctx.ref)}
+	for {
+		settled := state.Get("settled")
+		done := settled.Bool()
+		settled.Free()
+		if done {
+			break
+		}
+		if _, err := rt.ExecutePendingJob(); err == io.EOF {
+			return v.ctx.Undefined(), errors.New("promise did not settle")
+		} else if err != nil {
+			return v.ctx.Undefined(), err
+		}
+	}
+
+	fulfilled := state.Get("fulfilled")
+	defer fulfilled.Free()
+
+	value := state.Get("value")
+	if !fulfilled.Bool() {
+		defer value.Free()
+		return v.ctx.Undefined(), value.thrownError()
+	}
+	return value, nil
+}
+
+// CallMethod calls the method of v with the given name with this bound to v, returning an error should the method
+// not be callable or the call throw. args remain owned by the caller, and the returned value must be freed.
+func (v Value) CallMethod(name string, args ...Value) (Value, error) {
+	fn := v.Get(name)
+	defer fn.Free()
+
+	if fn.IsException() {
+		return v.ctx.Undefined(), v.ctx.Exception()
+	}
+	if !fn.IsFunction() {
+		return v.ctx.Undefined(), fmt.Errorf("%s is not a function", name)
+	}
+	return fn.Call(v, args...)
+}
+
+// IndexOf returns the index of the first element of the array v strictly equal to item, or -1 should there be none.
+func (v Value) IndexOf(item Value) (int64, error) {
+	idx, err := v.CallMethod("indexOf", item)
+	defer idx.Free()
+
+	if err != nil {
+		return -1, err
+	}
+	return idx.Int64(), nil
+}
+
+// Includes reports whether the array v holds an element equal to item following SameValueZero semantics, under
+// which NaN equals NaN.
+func (v Value) Includes(item Value) (bool, error) {
+	found, err := v.CallMethod("includes", item)
+	defer found.Free()
+
+	if err != nil {
+		return false, err
+	}
+	return found.Bool(), nil
+}
+
+// Replace returns a copy of the string v with the first occurrence of pattern replaced by replacement, following
+// the semantics of String.prototype.replace. Patterns such as $& in replacement are expanded.
+func (v Value) Replace(pattern, replacement string) (Value, error) {
+	if !v.IsString() {
+		return v.ctx.Undefined(), errors.New("value is not a string")
+	}
+
+	patternVal, replacementVal := v.ctx.String(pattern), v.ctx.String(replacement)
+	defer patternVal.Free()
+	defer replacementVal.Free()
+
+	return v.CallMethod("replace", patternVal, replacementVal)
+}
+
+// Split splits the string v into all substrings separated by sep, following the semantics of
+// String.prototype.split.
+func (v Value) Split(sep string) ([]string, error) {
+	if !v.IsString() {
+		return nil, errors.New("value is not a string")
+	}
+
+	sepVal := v.ctx.String(sep)
+	defer sepVal.Free()
+
+	parts, err := v.CallMethod("split", sepVal)
+	defer parts.Free()
+
+	if err != nil {
+		return nil, err
+	}
+
+	var result []string
+	if err := parts.Unmarshal(&result); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// Trim returns a copy of the string v with leading and trailing whitespace and line terminators removed.
+func (v Value) Trim() (Value, error) {
+	if !v.IsString() {
+		return v.ctx.Undefined(), errors.New("value is not a string")
+	}
+	return v.CallMethod("trim")
+}
+
+// CallConsuming calls the function v like Call, though it takes ownership of args and frees them once the call
+// returns. The caller must not use or free args afterwards.
+func (v Value) CallConsuming(this Value, args ...Value) (Value, error) {
+	defer func() {
+		for _, arg := range args {
+			arg.Free()
+		}
+	}()
+	return v.Call(this, args...)
+}
+
+// CallRaw calls the function v with this bound to this. Should the call throw, CallRaw returns false alongside the
+// thrown value as is, which the caller is responsible for freeing.
+func (v Value) CallRaw(this Value, args ...Value) (result Value, thrown Value, ok bool) {
+	val := v.ctx.call(v, this, args...)
+	if val.IsException() {
+		v.ctx.runtime.interrupted = nil
+		return v.ctx.Undefined(), Value{ctx: v.ctx, ref: C.JS_GetException(v.ctx.ref)}, false
+	}
+	return val, v.ctx.Undefined(), true
+}
+
+// New constructs a new object by calling the constructor v with args, as with the new operator, returning the
+// error thrown should v not be a constructor or the call throw. args remain owned by the caller, and the returned
+// value must be freed.
+func (v Value) New(args ...Value) (Value, error) {
+	v.ctx.runtime.checkThread()
+	defer v.ctx.enter()()
+
+	refs := make([]C.JSValue, len(args))
+	for i, arg := range args {
+		refs[i] = arg.ref
+	}
+
+	var argv *C.JSValue
+	if len(refs) > 0 {
+		argv = &refs[0]
+	}
+
+	val := Value{ctx: v.ctx, ref: C.JS_CallConstructor(v.ctx.ref, v.ref, C.int(len(refs)), argv)}
+	if val.IsException() {
+		return val, v.ctx.Exception()
+	}
+	return val, nil
+}
+
+func (ctx *Context) call(fn, this Value, args ...Value) Value {
+	ctx.runtime.checkThread()
+	defer ctx.enter()()
+
+	refs := make([]C.JSValue, len(args))
+	for i, arg := range args {
+		refs[i] = arg.ref
+	}
+
+	var argv *C.JSValue
+	if len(refs) > 0 {
+		argv = &refs[0]
+	}
+
+	return Value{ctx: ctx, ref: C.JS_Call(ctx.ref, fn.ref, this.ref, C.int(len(refs)), argv)}
+}
+
+func (ctx *Context) Null() Value {
+	return Value{ctx: ctx, ref: C.JS_NewNull()}
+}
+
+func (ctx *Context) Undefined() Value {
+	return Value{ctx: ctx, ref: C.JS_NewUndefined()}
+}
+
+func (ctx *Context) Uninitialized() Value {
+	return Value{ctx: ctx, ref: C.JS_NewUninitialized()}
+}
+
+// AggregateError returns a new AggregateError with the given message whose errors property is an array holding
+// errs. errs remain owned by the caller. The error is constructed from the built-in AggregateError, regardless of
+// what the AggregateError global has been reassigned to. Should construction fail, the returned value is an
+// exception whose error is pending, and may be retrieved through Exception.
+func (ctx *Context) AggregateError(errs []Value, message string) Value {
+	arr := ctx.Array()
+	if arr.IsException() {
+		return arr
+	}
+	defer arr.Free()
+
+	for i, err := range errs {
+		arr.SetByInt64(int64(i), err.Dup())
+	}
+
+	messagePtr := C.CString(message)
+	defer C.free(unsafe.Pointer(messagePtr))
+
+	return Value{ctx: ctx, ref: C.JS_NewAggregateError(ctx.ref, arr.ref, messagePtr, C.size_t(len(message)))}
+}
+
+func (ctx *Context) Error(err error) Value {
+	val := Value{ctx: ctx, ref: C.JS_NewError(ctx.ref)}
+	val.Set("message", ctx.String(err.Error()))
+	return val
+}
+
+func (ctx *Context) Bool(b bool) Value {
+	bv := 0
+	if b {
+		bv = 1
+	}
+	return Value{ctx: ctx, ref: C.JS_NewBool(ctx.ref, C.int(bv))}
+}
+
+func (ctx *Context) Int32(v int32) Value {
+	return Value{ctx: ctx, ref: C.JS_NewInt32(ctx.ref, C.int32_t(v))}
+}
+
+func (ctx *Context) Int64(v int64) Value {
+	return Value{ctx: ctx, ref: C.JS_NewInt64(ctx.ref, C.int64_t(v))}
+}
+
+func (ctx *Context) Uint32(v uint32) Value {
+	return Value{ctx: ctx, ref: C.JS_NewUint32(ctx.ref, C.uint32_t(v))}
+}
+
+func (ctx *Context) BigUint64(v uint64) Value {
+	return Value{ctx: ctx, ref: C.JS_NewBigUint64(ctx.ref, C.uint64_t(v))}
+}
+
+// BigInt returns a BigInt holding v, which may be of arbitrary size. A nil v is converted into null.
+func (ctx *Context) BigInt(v *big.Int) Value {
+	if v == nil {
+		return ctx.Null()
+	}
+	if v.IsInt64() {
+		return Value{ctx: ctx, ref: C.JS_NewBigInt64(ctx.ref, C.int64_t(v.Int64()))}
+	}
+
+	fn := ctx.eval(`(digits) => BigInt(digits)`)
+	if fn.IsException() {
+		return fn
+	}
+	defer fn.Free()
+
+	digits := ctx.String(v.String())
+	defer digits.Free()
+
+	return ctx.call(fn, ctx.Null(), digits)
+}
+
+func (ctx *Context) Float64(v float64) Value {
+	return Value{ctx: ctx, ref: C.JS_NewFloat64(ctx.ref, C.double(v))}
+}
+
+// String returns v as a JavaScript string. Embedded NUL bytes are kept, and invalid UTF-8 sequences are replaced
+// with U+FFFD.
+func (ctx *Context) String(v string) Value {
+	ptr := C.CString(v)
+	defer C.free(unsafe.Pointer(ptr))
+	return Value{ctx: ctx, ref: C.JS_NewStringLen(ctx.ref, ptr, C.size_t(len(v)))}
+}
+
+func (ctx *Context) date(t time.Time) Value {
+	ms := float64(t.Unix())*1e3 + float64(t.Nanosecond())/1e6
+	return Value{ctx: ctx, ref: C.JS_NewDate(ctx.ref, C.double(ms))}
+}
+
+// ArrayBufferFromReader reads r in its entirety into a new ArrayBuffer.
+func (ctx *Context) ArrayBufferFromReader(r io.Reader) (Value, error) {
+	b, err := ioutil.ReadAll(r)
+	if err != nil {
+		return ctx.Undefined(), err
+	}
+
+	buf := ctx.arrayBuffer(b)
+	if buf.IsException() {
+		return buf, ctx.Exception()
+	}
+	return buf, nil
+}
+
+// WritableStream returns an object whose write method forwards strings, ArrayBuffers and typed arrays to w as
+// bytes, and whose close method closes w should w be an io.Closer. Writing after close throws a TypeError.
+func (ctx *Context) WritableStream(w io.Writer) Value {
+	closed := false
+
+	stream := ctx.Object()
+	stream.SetFunction("write", func(ctx *Context, this Value, args []Value) Value {
+		if closed {
+			return ctx.ThrowTypeError("cannot write to a closed stream")
+		}
+		if len(args) == 0 {
+			return ctx.ThrowTypeError("write expects a string or a buffer")
+		}
+
+		var (
+			chunk []byte
+			err   error
+		)
+		if args[0].IsString() {
+			chunk = []byte(args[0].String())
+		} else if args[0].IsObject() {
+			chunk, err = args[0].bufferView()
+		} else {
+			return ctx.ThrowTypeError("write expects a string or a buffer")
+		}
+		if err != nil {
+			return ctx.ThrowError(err)
+		}
+
+		if _, err := w.Write(chunk); err != nil {
+			return ctx.ThrowError(err)
+		}
+		return ctx.Undefined()
+	})
+	stream.SetFunction("close", func(ctx *Context, this Value, args []Value) Value {
+		if closed {
+			return ctx.Undefined()
+		}
+		closed = true
+
+		if closer, ok := w.(io.Closer); ok {
+			if err := closer.Close(); err != nil {
+				return ctx.ThrowError(err)
+			}
+		}
+		return ctx.Undefined()
+	})
+	return stream
+}
+
+func (ctx *Context) arrayBuffer(b []byte) Value {
+	var ptr *C.uint8_t
+	if len(b) > 0 {
+		ptr = (*C.uint8_t)(unsafe.Pointer(&b[0]))
+	}
+	return Value{ctx: ctx, ref: C.JS_NewArrayBufferCopy(ctx.ref, ptr, C.size_t(len(b)))}
+}
+
+// Uint8Array returns a new Uint8Array holding a copy of b.
+func (ctx *Context) Uint8Array(b []byte) Value {
+	buf := ctx.arrayBuffer(b)
+	if buf.IsException() {
+		return buf
+	}
+	defer buf.Free()
+
+	return Value{ctx: ctx, ref: C.JS_NewUint8Array(ctx.ref, buf.ref)}
+}
+
+// copy deep-copies v by serializing and deserializing it, returning an exception should v contain values that
+// may not be serialized.
+func (ctx *Context) copy(v Value) Value {
+	var size C.size_t
+
+	ptr := C.JS_WriteObject(ctx.ref, &size, v.ref, C.JS_WRITE_OBJ_REFERENCE)
+	if ptr == nil {
+		return Value{ctx: ctx, ref: C.JS_NewException()}
+	}
+	defer C.js_free(ctx.ref, unsafe.Pointer(ptr))
+
+	return Value{ctx: ctx, ref: C.JS_ReadObject(ctx.ref, ptr, size, C.JS_READ_OBJ_REFERENCE)}
+}
+
+func (ctx *Context) Atom(v string) Atom {
+	ptr := C.CString(v)
+	defer C.free(unsafe.Pointer(ptr))
+	return Atom{ctx: ctx, ref: C.JS_NewAtom(ctx.ref, ptr)}
+}
+
+func (ctx *Context) eval(code string) Value { return ctx.evalFile(code, "code", 0) }
+
+func (ctx *Context) evalFile(code, filename string, flags C.int) Value {
+	ctx.runtime.checkThread()
+
+	codePtr := C.CString(code)
+	defer C.free(unsafe.Pointer(codePtr))
+
+	filenamePtr := C.CString(filename)
+	defer C.free(unsafe.Pointer(filenamePtr))
+
+	defer ctx.enter()()
+
+	return Value{ctx: ctx, ref: C.JS_Eval(ctx.ref, codePtr, C.size_t(len(code)), filenamePtr, flags)}
+}
+
+func (ctx *Context) Eval(code string) (Value, error) { return ctx.EvalFile(code, "code") }
+
+// EvalContext evaluates code, interrupting it once goctx is done. The returned InterruptedError wraps either
+// context.Canceled or context.DeadlineExceeded.
+func (ctx *Context) EvalContext(goctx context.Context, code string) (Value, error) {
+	if err := goctx.Err(); err != nil {
+		return ctx.Undefined(), &InterruptedError{Cause: err}
+	}
+
+	state := ctx.runtime
+	state.enableInterrupts(C.JS_GetRuntime(ctx.ref))
+
+	state.goctxs = append(state.goctxs, goctx)
+	defer func() { state.goctxs = state.goctxs[:len(state.goctxs)-1] }()
+
+	return ctx.Eval(code)
+}
+
+// EvalWithTimeout evaluates code, interrupting it should it not complete within the given timeout.
+func (ctx *Context) EvalWithTimeout(code string, timeout time.Duration) (Value, error) {
+	prev := ctx.deadline
+	defer func() { ctx.deadline = prev }()
+
+	deadline := time.Now().Add(timeout)
+	if !prev.IsZero() && prev.Before(deadline) {
+		deadline = prev
+	}
+	ctx.SetDeadline(deadline)
+
+	return ctx.Eval(code)
+}
+
+type EvalOptions struct {
+	// IsolatedGlobals evaluates code in a fresh realm holding only built-ins, such that code may neither read nor
+	// pollute the globals of the context. The realm has built-ins of its own, so values it returns are not instances
+	// of the built-ins of the context (i.e. `instanceof Array` is false, though Array.isArray holds). The realm is
+	// freed as soon as code has been evaluated should it neither return an object nor leave jobs pending. Otherwise,
+	// the returned value belongs to the realm, which is kept alive until it is freed through the Context method of
+	// the value, or else until the context is freed.
+	IsolatedGlobals bool
+
+	// ExecutePendingJobs executes all jobs pending once code has been evaluated, such that promises settled by code
+	// have their reactions run.
+	ExecutePendingJobs bool
+}
+
+func (ctx *Context) EvalWithOptions(code string, opts EvalOptions) (Value, error) {
+	target := ctx
+	if opts.IsolatedGlobals {
+		target = ctx.runtime.track(&Context{ref: newContext(C.JS_GetRuntime(ctx.ref)), runtime: ctx.runtime, transform: ctx.transform, deadline: ctx.deadline, parent: ctx})
+		ctx.realms = append(ctx.realms, target)
+	}
+
+	val, err := target.Eval(code)
+
+	if err == nil && opts.ExecutePendingJobs {
+		err = Runtime{ref: C.JS_GetRuntime(ctx.ref)}.ExecuteAllPendingJobs()
+	}
+
+	if target != ctx && !val.IsObject() && C.JS_IsJobPending(C.JS_GetRuntime(ctx.ref)) == 0 {
+		val.ctx = ctx
+		target.Free()
+	}
+	return val, err
+}
+
+// EvalBool evaluates code, coercing its result into a boolean following the semantics of JavaScript.
+func (ctx *Context) EvalBool(code string) (bool, error) {
+	val, err := ctx.Eval(code)
+	defer val.Free()
+
+	if err != nil {
+		return false, err
+	}
+	return val.Bool(), nil
+}
+
+// EvalExpr evaluates code as a single expression, so that e.g. `{a: 1}` evaluates to an object rather than a block.
+// A SyntaxError is returned without evaluating code should it not be exactly one expression. code is checked by
+// compiling it wrapped in brackets as well as parentheses, which no code closing either to smuggle in further
+// statements survives.
+func (ctx *Context) EvalExpr(code string) (Value, error) {
+	check, err := ctx.transformSource("["+code+"\n]", "code")
+	if err != nil {
+		return ctx.Undefined(), err
+	}
+
+	fn := ctx.evalFile(check, "code", C.JS_EVAL_FLAG_COMPILE_ONLY)
+	if fn.IsException() {
+		return fn, ctx.Exception()
+	}
+	fn.Free()
+
+	return ctx.Eval("(" + code + "\n)")
+}
+
+func (ctx *Context) EvalFile(code, filename string) (Value, error) {
+	code, err := ctx.transformSource(code, filename)
+	if err != nil {
+		return ctx.Undefined(), err
+	}
+
+	val := ctx.evalFile(code, filename, 0)
+	if val.IsException() {
+		return val, ctx.Exception()
+	}
+	return val, nil
+}
+
+// SetSourceTransform sets a function that transforms source code before it is evaluated or compiled, i.e. to strip
+// type annotations from or transpile code. Passing nil removes the transform.
+func (ctx *Context) SetSourceTransform(fn func(code, filename string) (string, error)) {
+	ctx.transform = fn
+}
+
+func (ctx *Context) transformSource(code, filename string) (string, error) {
+	if ctx.transform == nil {
+		return code, nil
+	}
+	return ctx.transform(code, filename)
+}
+
+// EvalModule evaluates code as an ES module, returning its namespace object. All jobs pending once the module has
+// been evaluated are executed, and an error is returned should either the module throw or any of the jobs fail.
+func (ctx *Context) EvalModule(code, filename string) (Value, error) {
+	code, err := ctx.transformSource(code, filename)
+	if err != nil {
+		return ctx.Undefined(), err
+	}
+
+	fn := ctx.evalFile(code, filename, C.JS_EVAL_TYPE_MODULE|C.JS_EVAL_FLAG_COMPILE_ONLY)
+	if fn.IsException() {
+		return fn, ctx.Exception()
+	}
+	m := (*C.JSModuleDef)(C.ValuePtr(fn.ref))
+
+	val := ctx.evalFunction(fn)
+	if val.IsException() {
+		return val, ctx.Exception()
+	}
+	val.Free()
+
+	if err := (Runtime{ref: C.JS_GetRuntime(ctx.ref)}).ExecuteAllPendingJobs(); err != nil {
+		return ctx.Undefined(), err
+	}
+
+	ns := Value{ctx: ctx, ref: C.JS_GetModuleNamespace(ctx.ref, m)}
+	if ns.IsException() {
+		return ns, ctx.Exception()
+	}
+	return ns, nil
+}
+
+// EvalModuleWithImports is like EvalModule, though modules imported by code whose names are keys of imports are
+// provided by the values of imports rather than by the module loader. Each own enumerable property of a value is
+// exported by name, and the value itself is the default export should it not have a property named default. imports
+// remain owned by the caller. As with any other module, a module provided by imports stays loaded within ctx, and
+// is reused by subsequent imports of the same name. An error is thus returned should imports provide a module
+// under a name already loaded from a different value.
+func (ctx *Context) EvalModuleWithImports(code, filename string, imports map[string]Value) (Value, error) {
+	for name, val := range imports {
+		if loaded, exists := ctx.provided[name]; exists && C.ValueIdentical(loaded.ref, val.ref) == 0 {
+			return ctx.Undefined(), fmt.Errorf("module '%s' is already loaded from a different value", name)
+		}
+	}
+
+	rt := C.JS_GetRuntime(ctx.ref)
+
+	prev := ctx.imports
+	ctx.imports = imports
+	ctx.runtime.importing++
+	ctx.runtime.updateModuleLoader(rt)
+
+	defer func() {
+		ctx.imports = prev
+		ctx.runtime.importing--
+		ctx.runtime.updateModuleLoader(rt)
+	}()
+
+	return ctx.EvalModule(code, filename)
+}
+
+// moduleExports returns the exports of a module provided by v through EvalModuleWithImports.
+func (v Value) moduleExports(ctx *Context) map[string]Value {
+	exports := make(map[string]Value)
+	if v.IsObject() {
+		names, _ := v.PropertyNamesWith(PropertyNamesOwnOnly)
+		for _, name := range names {
+			exports[name.String()] = v.GetByAtom(name.Atom)
+		}
+	}
+	if _, exists := exports["default"]; !exists {
+		exports["default"] = v.Dup()
+	}
+	return exports
+}
+
+// evalFunction evaluates the compiled script or module fn, taking ownership of fn.
+func (ctx *Context) evalFunction(fn Value) Value {
+	ctx.runtime.checkThread()
+	defer ctx.enter()()
+
+	return Value{ctx: ctx, ref: C.JS_EvalFunction(ctx.ref, fn.ref)}
+}
+
+// EvalReader evaluates the script read from r in its entirety.
+func (ctx *Context) EvalReader(r io.Reader, filename string) (Value, error) {
+	code, err := ioutil.ReadAll(r)
+	if err != nil {
+		return ctx.Undefined(), err
+	}
+	return ctx.EvalFile(string(code), filename)
+}
+
+// EvalModuleReader evaluates the module read from r in its entirety.
+func (ctx *Context) EvalModuleReader(r io.Reader, filename string) (Value, error) {
+	code, err := ioutil.ReadAll(r)
+	if err != nil {
+		return ctx.Undefined(), err
+	}
+	return ctx.EvalModule(string(code), filename)
+}
+
+// RunFile evaluates the file at path as a script, or as a module should its extension be .mjs.
+func (ctx *Context) RunFile(path string) (Value, error) {
+	code, err := ioutil.ReadFile(path)
+	if err != nil {
+		return ctx.Undefined(), err
+	}
+	if filepath.Ext(path) == ".mjs" {
+		return ctx.EvalModule(string(code), filepath.Base(path))
+	}
+	return ctx.EvalFile(string(code), filepath.Base(path))
+}
+
+// CompiledScript is a script that has been parsed and compiled once, and may be run many times over.
+type CompiledScript struct {
+	ctx *Context
+	fn  Value
+}
+
+// CompileScript parses and compiles code as a script once, such that it may be run through Run any number of times.
+// The returned script must be closed through Close once it is no longer needed.
+func (ctx *Context) CompileScript(code, filename string) (*CompiledScript, error) {
+	code, err := ctx.transformSource(code, filename)
+	if err != nil {
+		return nil, err
+	}
+
+	fn := ctx.evalFile(code, filename, C.JS_EVAL_FLAG_COMPILE_ONLY)
+	if fn.IsException() {
+		return nil, ctx.Exception()
+	}
+	return &CompiledScript{ctx: ctx, fn: fn}, nil
+}
+
+// ErrScriptClosed is returned when running a compiled script that has been closed.
+var ErrScriptClosed = errors.New("compiled script was closed")
+
+// Run evaluates the script, returning its completion value. ErrScriptClosed is returned should the script have been
+// closed.
+func (s *CompiledScript) Run() (Value, error) {
+	if s.fn.ctx == nil {
+		return s.ctx.Undefined(), ErrScriptClosed
+	}
+
+	val := s.ctx.evalFunction(s.fn.Dup())
+	if val.IsException() {
+		return val, s.ctx.Exception()
+	}
+	return val, nil
+}
+
+// Close releases the compiled script. Closing a script more than once has no effect.
+func (s *CompiledScript) Close() {
+	if s.fn.ctx == nil {
+		return
+	}
+	s.fn.Free()
+	s.fn = Value{}
+}
+
+// ErrBytecodeVersionMismatch is returned when evaluating bytecode that was not compiled by this version of QuickJS.
+var ErrBytecodeVersionMismatch = errors.New("bytecode was not compiled by this version of quickjs")
+
+var bytecodeHeader = []byte("quickjs " + C.GoString(C.Version()) + "\x00")
+
+// Compile compiles code into bytecode prefixed with a header identifying the version of QuickJS that compiled it.
+// The bytecode may be evaluated through EvalBytecode by any context of any runtime built from the same version of
+// QuickJS and this package.
+//
+// The bytecode format is not stable: it changes across versions of QuickJS, and bytecode compiled by a different
+// version is rejected with ErrBytecodeVersionMismatch. Bytecode should thus be treated as a cache that is rebuilt
+// from source whenever this package is upgraded, rather than as a distributable artifact.
+func (ctx *Context) Compile(code, filename string) ([]byte, error) {
+	code, err := ctx.transformSource(code, filename)
+	if err != nil {
+		return nil, err
+	}
+
+	fn := ctx.evalFile(code, filename, C.JS_EVAL_FLAG_COMPILE_ONLY)
+	if fn.IsException() {
+		return nil, ctx.Exception()
+	}
+	defer fn.Free()
+
+	var size C.size_t
+
+	ptr := C.JS_WriteObject(ctx.ref, &size, fn.ref, C.JS_WRITE_OBJ_BYTECODE)
+	if ptr == nil {
+		return nil, ctx.Exception()
+	}
+	defer C.js_free(ctx.ref, unsafe.Pointer(ptr))
+
+	buf := make([]byte, len(bytecodeHeader)+int(size))
+	copy(buf, bytecodeHeader)
+	copy(buf[len(bytecodeHeader):], (*[1 << 30]byte)(unsafe.Pointer(ptr))[:size:size])
+
+	return buf, nil
+}
+
+// EvalBytecode evaluates bytecode produced by Compile. Bytecode is not validated beyond its header, and must
+// therefore only ever be read from trusted sources.
+func (ctx *Context) EvalBytecode(buf []byte) (Value, error) {
+	if !bytes.HasPrefix(buf, bytecodeHeader) {
+		return ctx.Undefined(), ErrBytecodeVersionMismatch
+	}
+	buf = buf[len(bytecodeHeader):]
+
+	var ptr *C.uint8_t
+	if len(buf) > 0 {
+		ptr = (*C.uint8_t)(unsafe.Pointer(&buf[0]))
+	}
+
+	fn := Value{ctx: ctx, ref: C.JS_ReadObject(ctx.ref, ptr, C.size_t(len(buf)), C.JS_READ_OBJ_BYTECODE)}
+	if fn.IsException() {
+		return fn, ctx.Exception()
+	}
+
+	val := ctx.evalFunction(fn)
+	if val.IsException() {
+		return val, ctx.Exception()
+	}
+	return val, nil
+}
+
+// EvalWithGlobals evaluates code with the given globals defined, removing them afterwards and restoring any globals
+// that they shadowed. Ownership of each Value in globals is transferred to the context. Globals are defined rather
+// than assigned, such that they replace accessors and read-only globals alike. An error is returned without code
+// being evaluated should any of them shadow a global that is not configurable, e.g. NaN.
+func (ctx *Context) EvalWithGlobals(code string, globals map[string]Value) (Value, error) {
+	global := ctx.Globals()
+
+	type shadowed struct {
+		name    string
+		atom    Atom
+		desc    C.JSPropertyDescriptor
+		existed bool
+	}
+
+	restore := make([]shadowed, 0, len(globals))
+	defer func() {
+		for _, s := range restore {
+			if !s.existed {
+				C.JS_DeleteProperty(ctx.ref, global.ref, s.atom.ref, C.int(0))
+				s.atom.Free()
+				continue
+			}
+
+			flags := s.desc.flags&C.JS_PROP_C_W_E | C.JS_PROP_HAS_CONFIGURABLE | C.JS_PROP_HAS_ENUMERABLE
+			if s.desc.flags&C.JS_PROP_GETSET != 0 {
+				flags |= C.JS_PROP_HAS_GET | C.JS_PROP_HAS_SET
+			} else {
+				flags |= C.JS_PROP_HAS_VALUE | C.JS_PROP_HAS_WRITABLE
+			}
+			C.JS_DefineProperty(ctx.ref, global.ref, s.atom.ref, s.desc.value, s.desc.getter, s.desc.setter, flags)
+
+			C.JS_FreeValue(ctx.ref, s.desc.value)
+			C.JS_FreeValue(ctx.ref, s.desc.getter)
+			C.JS_FreeValue(ctx.ref, s.desc.setter)
+			s.atom.Free()
+		}
+	}()
+
+	for name := range globals {
+		s := shadowed{name: name, atom: ctx.Atom(name)}
+
+		ret := C.JS_GetOwnProperty(ctx.ref, &s.desc, global.ref, s.atom.ref)
+		if ret < 0 {
+			s.atom.Free()
+			for _, val := range globals {
+				val.Free()
+			}
+			return ctx.Undefined(), ctx.Exception()
+		}
+		s.existed = ret == 1
+		restore = append(restore, s)
+
+		if s.existed && s.desc.flags&C.JS_PROP_CONFIGURABLE == 0 {
+			for _, val := range globals {
+				val.Free()
+			}
+			return ctx.Undefined(), fmt.Errorf("global %s is not configurable and cannot be shadowed", name)
+		}
+	}
+
+	for _, s := range restore {
+		C.JS_DefinePropertyValue(ctx.ref, global.ref, s.atom.ref, globals[s.name].ref, C.JS_PROP_C_W_E)
+	}
+
+	return ctx.Eval(code)
+}
+
+// GlobalSnapshot is a snapshot of the global bindings of a context taken by SnapshotGlobals.
+type GlobalSnapshot struct {
+	restore Value
+}
+
+func (s *GlobalSnapshot) Free() { s.restore.Free() }
+
+// SnapshotGlobals captures the properties of the global object such that they may later be restored through
+// RestoreGlobals. Bindings declared with var or function at the top level of a script live on the global object
+// and are captured, whereas those declared with let, const or class do not, and are thus not captured.
+func (ctx *Context) SnapshotGlobals() (*GlobalSnapshot, error) {
+	restore := ctx.eval(`(() => {
+		const { defineProperty, getOwnPropertyDescriptor, getOwnPropertyDescriptors, is } = Object;
+		const { ownKeys, deleteProperty } = Reflect;
+		const hasOwn = Function.prototype.call.bind(Object.prototype.hasOwnProperty);
+
+		const snapshot = getOwnPropertyDescriptors(globalThis);
+		const same = (a, b) => is(a.value, b.value) && a.get === b.get && a.set === b.set &&
+			a.writable === b.writable && a.enumerable === b.enumerable && a.configurable === b.configurable;
+
+		return () => {
+			const undeletable = [];
+			for (const key of ownKeys(globalThis)) {
+				if (!hasOwn(snapshot, key) && !deleteProperty(globalThis, key)) undeletable.push(key);
+			}
+			for (const key of ownKeys(snapshot)) {
+				const current = getOwnPropertyDescriptor(globalThis, key);
+				if (current === undefined || !same(current, snapshot[key])) defineProperty(globalThis, key, snapshot[key]);
+			}
+			return undeletable;
+		};
+	})()`)
+	if restore.IsException() {
+		return nil, ctx.Exception()
+	}
+	return &GlobalSnapshot{restore: restore}, nil
+}
+
+// RestoreGlobals restores the global object to the given snapshot, removing globals that were added, redefining
+// globals that were deleted, and resetting globals that were modified since the snapshot was taken. Globals added
+// are removed even should they not be configurable, e.g. should they have been declared with var.
+func (ctx *Context) RestoreGlobals(snapshot *GlobalSnapshot) error {
+	undeletable, err := snapshot.restore.Call(ctx.Undefined())
+	defer undeletable.Free()
+
+	if err != nil {
+		return err
+	}
+
+	for i, n := uint32(0), uint32(undeletable.Len()); i < n; i++ {
+		key := undeletable.GetByUint32(i)
+		atom := C.JS_ValueToAtom(ctx.ref, key.ref)
+		key.Free()
+
+		ret := C.JS_DeleteGlobalBinding(ctx.ref, atom)
+		C.JS_FreeAtom(ctx.ref, atom)
+		if ret < 0 {
+			return ctx.Exception()
+		}
+	}
+	return nil
+}
+
+// HardenPrototypes freezes the prototypes of the built-in constructors, such as Object.prototype and
+// Array.prototype, along with the constructors themselves, such that scripts cannot pollute them. Assigning to a
+// property of a frozen prototype throws a TypeError in strict mode and is ignored otherwise. Note that this also
+// prevents assigning to properties inherited from a frozen prototype, such as toString, on ordinary objects;
+// Object.defineProperty may be used instead.
+func (ctx *Context) HardenPrototypes() error {
+	val := ctx.eval(`(() => {
+		"use strict";
+
+		const constructors = [
+			Object, Function, Array, String, Number, Boolean, Symbol, BigInt, Date, RegExp, Promise, Proxy,
+			Map, Set, WeakMap, WeakSet, ArrayBuffer, SharedArrayBuffer, DataView,
+			Error, EvalError, RangeError, ReferenceError, SyntaxError, TypeError, URIError, InternalError,
+			Int8Array, Uint8Array, Uint8ClampedArray, Int16Array, Uint16Array, Int32Array, Uint32Array,
+			Float32Array, Float64Array, BigInt64Array, BigUint64Array,
+			globalThis.BigFloat, globalThis.BigDecimal, globalThis.BigFloatEnv, globalThis.Operators,
+			Object.getPrototypeOf(Int8Array),
+			Object.getPrototypeOf(function*() {}).constructor,
+			Object.getPrototypeOf(async function() {}).constructor,
+			Object.getPrototypeOf(async function*() {}).constructor,
+		];
+
+		const prototypes = [
+			Object.getPrototypeOf([][Symbol.iterator]()),
+			Object.getPrototypeOf(Object.getPrototypeOf([][Symbol.iterator]())),
+			Object.getPrototypeOf(function*() {}).prototype,
+			Object.getPrototypeOf(async function*() {}).prototype,
+		];
+
+		for (const constructor of constructors) {
+			if (typeof constructor !== "function") continue;
+			if (constructor.prototype) Object.freeze(constructor.prototype);
+			Object.freeze(constructor);
+		}
+		for (const prototype of prototypes) Object.freeze(prototype);
+
+		for (const namespace of [Math, JSON, Reflect]) Object.freeze(namespace);
+	})()`)
+	if val.IsException() {
+		return ctx.Exception()
+	}
+	val.Free()
+	return nil
+}
+
+// Sandbox disables eval and all Function constructors, and freezes the global object. Any globals that scripts
+// should have access to must be set before Sandbox is called.
+func (ctx *Context) Sandbox() error {
+	val := ctx.eval(`(() => {
+		"use strict";
+
+		const disabled = (name) => function() { throw new EvalError(name + " is disabled in this sandbox"); };
+
+		const constructors = [
+			Function,
+			Object.getPrototypeOf(function*() {}).constructor,
+			Object.getPrototypeOf(async function() {}).constructor,
+			Object.getPrototypeOf(async function*() {}).constructor,
+		];
+
+		for (const constructor of constructors) {
+			const stub = disabled(constructor.name);
+			stub.prototype = constructor.prototype;
+			Object.defineProperty(constructor.prototype, "constructor", {value: stub});
+			if (globalThis[constructor.name] === constructor) globalThis[constructor.name] = stub;
+		}
+
+		globalThis.eval = disabled("eval");
+
+		Object.freeze(globalThis);
+	})()`)
+	if val.IsException() {
+		return ctx.Exception()
+	}
+	val.Free()
+	return nil
+}
+
+// Globals returns the global object of the context. The returned handle is cached and owned by the context, and must
+// not be freed; use GlobalThis for a handle that is safe to free.
+func (ctx *Context) Globals() Value {
+	if ctx.globals == nil {
+		ctx.globals = &Value{
+			ctx: ctx,
+			ref: C.JS_GetGlobalObject(ctx.ref),
+		}
+	}
+	return *ctx.globals
+}
+
+// GlobalThis returns a new handle to the global object of the context, which the caller owns and must free. Freeing
+// it does not affect the handle cached by Globals.
+func (ctx *Context) GlobalThis() Value {
+	return Value{ctx: ctx, ref: C.JS_GetGlobalObject(ctx.ref)}
+}
+
+func (ctx *Context) Throw(v Value) Value {
+	return Value{ctx: ctx, ref: C.JS_Throw(ctx.ref, v.ref)}
+}
+
+func (ctx *Context) ThrowError(err error) Value { return ctx.Throw(ctx.Error(err)) }
+
+func (ctx *Context) ThrowSyntaxError(format string, args ...interface{}) Value {
+	cause := fmt.Sprintf(format, args...)
+	causePtr := C.CString(cause)
+	defer C.free(unsafe.Pointer(causePtr))
+	return Value{ctx: ctx, ref: C.ThrowSyntaxError(ctx.ref, causePtr)}
+}
+
+func (ctx *Context) ThrowTypeError(format string, args ...interface{}) Value {
+	cause := fmt.Sprintf(format, args...)
+	causePtr := C.CString(cause)
+	defer C.free(unsafe.Pointer(causePtr))
+	return Value{ctx: ctx, ref: C.ThrowTypeError(ctx.ref, causePtr)}
+}
+
+func (ctx *Context) ThrowReferenceError(format string, args ...interface{}) Value {
+	cause := fmt.Sprintf(format, args...)
+	causePtr := C.CString(cause)
+	defer C.free(unsafe.Pointer(causePtr))
+	return Value{ctx: ctx, ref: C.ThrowReferenceError(ctx.ref, causePtr)}
+}
+
+func (ctx *Context) ThrowRangeError(format string, args ...interface{}) Value {
+	cause := fmt.Sprintf(format, args...)
+	causePtr := C.CString(cause)
+	defer C.free(unsafe.Pointer(causePtr))
+	return Value{ctx: ctx, ref: C.ThrowRangeError(ctx.ref, causePtr)}
+}
+
+func (ctx *Context) ThrowInternalError(format string, args ...interface{}) Value {
+	cause := fmt.Sprintf(format, args...)
+	causePtr := C.CString(cause)
+	defer C.free(unsafe.Pointer(causePtr))
+	return Value{ctx: ctx, ref: C.ThrowInternalError(ctx.ref, causePtr)}
+}
+
+func (ctx *Context) Exception() error {
+	val := Value{ctx: ctx, ref: C.JS_GetException(ctx.ref)}
+	defer val.Free()
+
+	if err := ctx.runtime.interrupted; err != nil {
+		ctx.runtime.interrupted = nil
+		return err
+	}
+	return val.thrownError()
+}
+
+// thrownError converts the thrown value v into an error, even should v not be an Error.
+func (v Value) thrownError() error {
+	if err := v.Error(); err != nil {
+		return err
+	}
+	return &Error{Cause: v.String(), format: v.ctx.runtime.formatError}
+}
+
+func (ctx *Context) Object() Value {
+	return Value{ctx: ctx, ref: C.JS_NewObject(ctx.ref)}
+}
+
+func (ctx *Context) Array() Value {
+	return Value{ctx: ctx, ref: C.JS_NewArray(ctx.ref)}
+}
+
+// ArrayWithCapacity returns an array whose length is set upfront to n, with storage for n elements reserved such
+// that setting its elements in order does not reallocate. Elements that are not set remain holes.
+func (ctx *Context) ArrayWithCapacity(n int) Value {
+	if n < 0 || int64(n) > math.MaxUint32 {
+		return ctx.ThrowRangeError("invalid array length %d", n)
+	}
+	return Value{ctx: ctx, ref: C.JS_NewArrayWithCapacity(ctx.ref, C.uint32_t(n))}
+}
+
+// LazyObject returns an object whose properties are materialized on first access by calling getter with the name of
+// the property, which returns the value of the property or false should it not exist. Properties are materialized
+// at most once, and the object takes ownership of the values returned by getter. Enumerating the keys of the object
+// only yields properties that were materialized.
+func (ctx *Context) LazyObject(getter func(key string) (Value, bool)) Value {
+	return ctx.LazyObjectWithKeys(getter, nil)
+}
+
+// LazyObjectWithKeys is like LazyObject, though enumerating the keys of the object yields the keys returned by keys,
+// materializing them as needed.
+func (ctx *Context) LazyObjectWithKeys(getter func(key string) (Value, bool), keys func() []string) Value {
+	val := ctx.eval(`(lookup, keys) => {
+		const hasOwn = Function.prototype.call.bind(Object.prototype.hasOwnProperty);
+		const missing = new Set();
+
+		const materialize = (target, key) => {
+			if (typeof key === "string" && !hasOwn(target, key) && !missing.has(key) && !lookup(target, key)) {
+				missing.add(key);
+			}
+		};
+
+		const handler = {
+			get(target, key, receiver) {
+				materialize(target, key);
+				return Reflect.get(target, key, receiver);
+			},
+			has(target, key) {
+				materialize(target, key);
+				return Reflect.has(target, key);
+			},
+			getOwnPropertyDescriptor(target, key) {
+				materialize(target, key);
+				return Reflect.getOwnPropertyDescriptor(target, key);
+			},
+		};
+		if (keys !== undefined) {
+			handler.ownKeys = (target) => [...new Set([...Reflect.ownKeys(target), ...keys()])];
+		}
+
+		return new Proxy({}, handler);
+	}`)
+	if val.IsException() {
+		return val
+	}
+	defer val.Free()
+
+	lookup := ctx.Function(func(ctx *Context, this Value, args []Value) Value {
+		prop, ok := getter(args[1].String())
+		if ok {
+			args[0].Set(args[1].String(), prop)
+		}
+		return ctx.Bool(ok)
+	})
+	defer lookup.Free()
+
+	if keys == nil {
+		return ctx.call(val, ctx.Null(), lookup)
+	}
+
+	keysFn := ctx.Function(func(ctx *Context, this Value, args []Value) Value {
+		arr := ctx.Array()
+		for i, key := range keys() {
+			arr.SetByUint32(uint32(i), ctx.String(key))
+		}
+		return arr
+	})
+	defer keysFn.Free()
+
+	return ctx.call(val, ctx.Null(), lookup, keysFn)
+}
+
+type Atom struct {
+	ctx *Context
+	ref C.JSAtom
+}
+
+func (a Atom) Free() { C.JS_FreeAtom(a.ctx.ref, a.ref) }
+
+func (a Atom) String() string {
+	ptr := C.JS_AtomToCString(a.ctx.ref, a.ref)
+	defer C.JS_FreeCString(a.ctx.ref, ptr)
+	return C.GoString(ptr)
+}
+
+func (a Atom) Value() Value {
+	return Value{ctx: a.ctx, ref: C.JS_AtomToValue(a.ctx.ref, a.ref)}
+}
+
+type Value struct {
+	ctx *Context
+	ref C.JSValue
+	str *string
+}
+
+func (v Value) Free() {
+	v.ctx.runtime.checkThread()
+	C.JS_FreeValue(v.ctx.ref, v.ref)
+}
+
+func (v Value) ptr() uintptr { return uintptr(C.ValuePtr(v.ref)) }
+
+// Dup returns a new reference to v, keeping v alive until the returned value is freed. Every call to Dup must be
+// paired with a call to Free on the returned value, which may outlive the scope v was obtained from, e.g. to be
+// cached in a Go map.
+func (v Value) Dup() Value { return Value{ctx: v.ctx, ref: C.JS_DupValue(v.ctx.ref, v.ref)} }
+
+func (v Value) Context() *Context { return v.ctx }
+
+func (v Value) Bool() bool { return C.JS_ToBool(v.ctx.ref, v.ref) == 1 }
+
+// String returns v converted into a Go string. Embedded NUL characters are kept.
+func (v Value) String() string {
+	v.ctx.runtime.checkThread()
+
+	var size C.size_t
+
+	ptr := C.JS_ToCStringLen(v.ctx.ref, &size, v.ref)
+	defer C.JS_FreeCString(v.ctx.ref, ptr)
+	return C.GoStringN(ptr, C.int(size))
+}
+
+// CachedString returns v converted into a Go string, memoizing the result on v should v be a string. Strings are
+// immutable in JavaScript, so repeated reads through the same wrapper skip the conversion. Note that a wrapper holding
+// a memoized string no longer compares equal through == to other wrappers of the same value.
+func (v *Value) CachedString() string {
+	if v.str != nil {
+		return *v.str
+	}
+	str := v.String()
+	if v.IsString() {
+		v.str = &str
+	}
+	return str
+}
+
+// Int64 converts v into an int64, returning 0 should the conversion fail. See ToInt64.
+func (v Value) Int64() int64 { val, _ := v.ToInt64(); return val }
+
+// Int32 converts v into an int32, returning 0 should the conversion fail. See ToInt32.
+func (v Value) Int32() int32 { val, _ := v.ToInt32(); return val }
+
+// Uint32 converts v into a uint32, returning 0 should the conversion fail. See ToUint32.
+func (v Value) Uint32() uint32 { val, _ := v.ToUint32(); return val }
+
+// Float64 converts v into a float64, returning 0 should the conversion fail. See ToFloat64.
+func (v Value) Float64() float64 { val, _ := v.ToFloat64(); return val }
+
+// ToInt64 converts v into an int64 following the semantics of ToNumber in JavaScript, returning the error thrown
+// should the conversion fail, e.g. as v is a BigInt or a Symbol, or as v has a valueOf method that throws.
+func (v Value) ToInt64() (int64, error) {
+	val := C.int64_t(0)
+	if C.JS_ToInt64(v.ctx.ref, &val, v.ref) < 0 {
+		return 0, v.ctx.Exception()
+	}
+	return int64(val), nil
+}
+
+// ToInt32 is like ToInt64, though it converts v into an int32.
+func (v Value) ToInt32() (int32, error) {
+	val := C.int32_t(0)
+	if C.JS_ToInt32(v.ctx.ref, &val, v.ref) < 0 {
+		return 0, v.ctx.Exception()
+	}
+	return int32(val), nil
+}
+
+// ToUint32 is like ToInt64, though it converts v into a uint32.
+func (v Value) ToUint32() (uint32, error) {
+	val := C.uint32_t(0)
+	if C.JS_ToUint32(v.ctx.ref, &val, v.ref) < 0 {
+		return 0, v.ctx.Exception()
+	}
+	return uint32(val), nil
+}
+
+// ToFloat64 is like ToInt64, though it converts v into a float64.
+func (v Value) ToFloat64() (float64, error) {
+	val := C.double(0)
+	if C.JS_ToFloat64(v.ctx.ref, &val, v.ref) < 0 {
+		return 0, v.ctx.Exception()
+	}
+	return float64(val), nil
+}
+
+func (v Value) BigInt() *big.Int {
+	if !v.IsBigInt() {
+		return nil
+	}
+	val, ok := new(big.Int).SetString(v.String(), 10)
+	if !ok {
+		return nil
+	}
+	return val
+}
+
+func (v Value) BigFloat() *big.Float {
+	if !v.IsBigDecimal() && !v.IsBigFloat() {
+		return nil
+	}
+	val, ok := new(big.Float).SetString(v.String())
+	if !ok {
+		return nil
+	}
+	return val
+}
+
+// Add returns v + other, following the semantics of the + operator in JavaScript.
+func (v Value) Add(other Value) (Value, error) { return v.binaryOp(opAdd, other) }
+
+// Sub returns v - other, following the semantics of the - operator in JavaScript.
+func (v Value) Sub(other Value) (Value, error) { return v.binaryOp(opSub, other) }
+
+// Mul returns v * other, following the semantics of the * operator in JavaScript.
+func (v Value) Mul(other Value) (Value, error) { return v.binaryOp(opMul, other) }
+
+// Div returns v / other, following the semantics of the / operator in JavaScript.
+func (v Value) Div(other Value) (Value, error) { return v.binaryOp(opDiv, other) }
+
+const (
+	opAdd = iota
+	opSub
+	opMul
+	opDiv
+)
+
+// binaryOp applies the operator op to v and other. The functions applying each operator are compiled once per
+// context, and cached until the context is freed.
+func (v Value) binaryOp(op int, other Value) (Value, error) {
+	ctx := v.ctx
+	if ctx.operators == nil {
+		fns := ctx.eval(`[(a, b) => a + b, (a, b) => a - b, (a, b) => a * b, (a, b) => a / b]`)
+		if fns.IsException() {
+			return fns, ctx.Exception()
+		}
+		defer fns.Free()
+
+		for i := opAdd; i <= opDiv; i++ {
+			ctx.operators = append(ctx.operators, fns.GetByUint32(uint32(i)))
+		}
+	}
+
+	return ctx.operators[op].Call(ctx.Null(), v, other)
+}
+
+// JSON serializes v into JSON, returning an error should v not be serializable, e.g. as it references itself. An
+// empty string is returned should v have no JSON representation, such as undefined or a function.
+func (v Value) JSON() (string, error) {
+	val, err := v.jsonStringify()
+	if err != nil {
+		return "", err
+	}
+	defer val.Free()
+
+	if val.IsUndefined() {
+		return "", nil
+	}
+	return val.String(), nil
+}
+
+// ParseJSON parses data as JSON into a value, returning the SyntaxError thrown should data not be valid JSON.
+func (ctx *Context) ParseJSON(data string) (Value, error) {
+	ptr := C.CString(data)
+	defer C.free(unsafe.Pointer(ptr))
+
+	return ctx.parseJSON(ptr, len(data))
+}
+
+// ParseJSONBytes is like ParseJSON, though it parses data without converting it into a string first. data is still
+// copied once into C memory, as the engine requires its input to be NUL-terminated.
+func (ctx *Context) ParseJSONBytes(data []byte) (Value, error) {
+	ptr := (*C.char)(C.malloc(C.size_t(len(data) + 1)))
+	defer C.free(unsafe.Pointer(ptr))
+
+	buf := unsafe.Slice((*byte)(unsafe.Pointer(ptr)), len(data)+1)
+	copy(buf, data)
+	buf[len(data)] = 0
+
+	return ctx.parseJSON(ptr, len(data))
+}
+
+// StreamJSON parses the JSON document read from r, calling onValue with each element of the document should it be
+// an array, or with the document itself otherwise. Elements are parsed and passed to onValue one at a time, so that
+// only a single element is held in memory at once. path is the location of the value within the document, e.g.
+// "[3]" for the fourth element of an array, or "" for the document itself. The value passed to onValue is freed
+// once onValue returns. Streaming stops at the first error returned by onValue, which is returned.
+func (ctx *Context) StreamJSON(r io.Reader, onValue func(path string, v Value) error) error {
+	br := bufio.NewReader(r)
+
+	for {
+		c, err := br.ReadByte()
+		if err != nil {
+			return err
+		}
+		if c != ' ' && c != '\t' && c != '\n' && c != '\r' {
+			if err := br.UnreadByte(); err != nil {
+				return err
+			}
+			break
+		}
+	}
+
+	emit := func(path string, data []byte) error {
+		val, err := ctx.ParseJSONBytes(data)
+		if err != nil {
+			return err
+		}
+		defer val.Free()
+
+		return onValue(path, val)
+	}
+
+	dec := json.NewDecoder(br)
+
+	if c, _ := br.Peek(1); c[0] != '[' {
+		var doc json.RawMessage
+		if err := dec.Decode(&doc); err != nil {
+			return err
+		}
+		return emit("", doc)
+	}
+
+	if _, err := dec.Token(); err != nil {
+		return err
+	}
+	for i := 0; dec.More(); i++ {
+		var elem json.RawMessage
+		if err := dec.Decode(&elem); err != nil {
+			return err
+		}
+		if err := emit(fmt.Sprintf("[%d]", i), elem); err != nil {
+			return err
+		}
+	}
+	_, err := dec.Token()
+	return err
+}
+
+// parseJSON parses the size bytes at ptr, which must be followed by a NUL terminator.
+func (ctx *Context) parseJSON(ptr *C.char, size int) (Value, error) {
+	ctx.runtime.checkThread()
+
+	filenamePtr := C.CString("<json>")
+	defer C.free(unsafe.Pointer(filenamePtr))
+
+	val := Value{ctx: ctx, ref: C.JS_ParseJSON(ctx.ref, ptr, C.size_t(size), filenamePtr)}
+	if val.IsException() {
+		return val, ctx.Exception()
+	}
+	return val, nil
+}
+
+// JSONStringifyLimit serializes v into JSON, returning at most maxBytes bytes of output. The returned bool
+// reports whether the output was truncated to fit within maxBytes. Serialization stops descending into values once
+// the output is known to exceed maxBytes, such that the memory and time spent serializing a large value are bounded
+// by maxBytes rather than by the size of the value. toJSON methods of the values skipped may still be called.
+func (v Value) JSONStringifyLimit(maxBytes int) (string, bool, error) {
+	if maxBytes < 0 {
+		return "", false, errors.New("maxBytes must not be negative")
+	}
+
+	factory := v.ctx.eval(`(limit) => {
+		let size = 0;
+		return function(key, value) {
+			if (size > limit) return undefined;
+			switch (typeof value) {
+			case "undefined": case "function": case "symbol": return value;
+			case "string": size += value.length + 2; break;
+			case "number": size += isFinite(value) ? String(value).length : 4; break;
+			case "boolean": size += value ? 4 : 5; break;
+			case "object": size += value === null ? 4 : 1; break;
+			}
+			if (key !== "" && !Array.isArray(this)) size += key.length + 3;
+			return value;
+		};
+	}`)
+	if factory.IsException() {
+		return "", false, v.ctx.Exception()
+	}
+	defer factory.Free()
+
+	limit := v.ctx.Int64(int64(maxBytes))
+	replacer := v.ctx.call(factory, v.ctx.Null(), limit)
+	if replacer.IsException() {
+		return "", false, v.ctx.Exception()
+	}
+	defer replacer.Free()
+
+	val := Value{ctx: v.ctx, ref: C.JS_JSONStringify(v.ctx.ref, v.ref, replacer.ref, C.JS_NewUndefined())}
+	if val.IsException() {
+		return "", false, v.ctx.Exception()
+	}
+	defer val.Free()
+
+	if val.IsUndefined() {
+		return "", false, nil
+	}
+
+	var size C.size_t
+
+	ptr := C.JS_ToCStringLen(v.ctx.ref, &size, val.ref)
+	defer C.JS_FreeCString(v.ctx.ref, ptr)
+
+	if int(size) <= maxBytes {
+		return C.GoStringN(ptr, C.int(size)), false, nil
+	}
+
+	json := C.GoStringN(ptr, C.int(maxBytes))
+	for len(json) > 0 {
+		if r, n := utf8.DecodeLastRuneInString(json); r != utf8.RuneError || n > 1 {
+			break
+		}
+		json = json[:len(json)-1]
+	}
+
+	return json, true, nil
+}
+
+// ToJSONValue returns the result of invoking v's toJSON method, or a duplicate of v should it not have one. The
+// returned value must be freed by the caller.
+func (v Value) ToJSONValue() (Value, error) {
+	if !v.IsObject() {
+		return v.Dup(), nil
+	}
+
+	toJSON := v.Get("toJSON")
+	defer toJSON.Free()
+
+	if toJSON.IsException() {
+		return toJSON, v.ctx.Exception()
+	}
+	if !toJSON.IsFunction() {
+		return v.Dup(), nil
+	}
+
+	key := v.ctx.String("")
+	defer key.Free()
+
+	val := v.ctx.call(toJSON, v, key)
+	if val.IsException() {
+		return val, v.ctx.Exception()
+	}
+	return val, nil
 }
 
-func (ctx *Context) Float64(v float64) Value {
-	return Value{ctx: ctx, ref: C.JS_NewFloat64(ctx.ref, C.double(v))}
+func (v Value) jsonStringify() (Value, error) {
+	val := Value{ctx: v.ctx, ref: C.JS_JSONStringify(v.ctx.ref, v.ref, C.JS_NewUndefined(), C.JS_NewUndefined())}
+	if val.IsException() {
+		return val, v.ctx.Exception()
+	}
+	return val, nil
 }
 
-func (ctx *Context) String(v string) Value {
-	ptr := C.CString(v)
-	defer C.free(unsafe.Pointer(ptr))
-	return Value{ctx: ctx, ref: C.JS_NewString(ctx.ref, ptr)}
+func (v Value) Source() (string, bool) {
+	if !v.IsFunction() {
+		return "", false
+	}
+	return v.String(), true
 }
 
-func (ctx *Context) Atom(v string) Atom {
-	ptr := C.CString(v)
-	defer C.free(unsafe.Pointer(ptr))
-	return Atom{ctx: ctx, ref: C.JS_NewAtom(ctx.ref, ptr)}
-}
+func (v Value) ConstructorName() string {
+	if v.IsNull() || v.IsUndefined() {
+		return ""
+	}
 
-func (ctx *Context) eval(code string) Value { return ctx.evalFile(code, "code") }
+	constructor := v.Get("constructor")
+	defer constructor.Free()
 
-func (ctx *Context) evalFile(code, filename string) Value {
-	codePtr := C.CString(code)
-	defer C.free(unsafe.Pointer(codePtr))
+	if !constructor.IsFunction() {
+		return ""
+	}
 
-	filenamePtr := C.CString(filename)
-	defer C.free(unsafe.Pointer(filenamePtr))
+	name := constructor.Get("name")
+	defer name.Free()
 
-	return Value{ctx: ctx, ref: C.JS_Eval(ctx.ref, codePtr, C.size_t(len(code)), filenamePtr, C.int(0))}
+	return name.String()
 }
 
-func (ctx *Context) Eval(code string) (Value, error) { return ctx.EvalFile(code, "code") }
+func (v Value) PrototypeChain() ([]Value, error) {
+	var chain []Value
 
-func (ctx *Context) EvalFile(code, filename string) (Value, error) {
-	val := ctx.evalFile(code, filename)
-	if val.IsException() {
-		return val, ctx.Exception()
+	proto := Value{ctx: v.ctx, ref: C.JS_GetPrototype(v.ctx.ref, v.ref)}
+	for proto.IsObject() {
+		chain = append(chain, proto)
+		proto = Value{ctx: v.ctx, ref: C.JS_GetPrototype(v.ctx.ref, proto.ref)}
 	}
-	return val, nil
+	if proto.IsException() {
+		for _, val := range chain {
+			val.Free()
+		}
+		return nil, v.ctx.Exception()
+	}
+
+	return chain, nil
 }
 
-func (ctx *Context) Globals() Value {
-	if ctx.globals == nil {
-		ctx.globals = &Value{
-			ctx: ctx,
-			ref: C.JS_GetGlobalObject(ctx.ref),
-		}
+func (v Value) Base64Bytes() ([]byte, error) {
+	if !v.IsString() {
+		return nil, errors.New("value is not a string")
 	}
-	return *ctx.globals
+	return base64.StdEncoding.DecodeString(v.String())
 }
 
-func (ctx *Context) Throw(v Value) Value {
-	return Value{ctx: ctx, ref: C.JS_Throw(ctx.ref, v.ref)}
+func (v Value) HexBytes() ([]byte, error) {
+	if !v.IsString() {
+		return nil, errors.New("value is not a string")
+	}
+	return hex.DecodeString(v.String())
 }
 
-func (ctx *Context) ThrowError(err error) Value { return ctx.Throw(ctx.Error(err)) }
+// ToBytes returns a copy of the bytes viewed by the typed array v, or held by the ArrayBuffer v. An error is
+// returned should v not be either, or should its buffer have been detached.
+func (v Value) ToBytes() ([]byte, error) {
+	if !v.IsObject() {
+		return nil, errors.New("value is not an ArrayBuffer or typed array")
+	}
 
-func (ctx *Context) ThrowSyntaxError(format string, args ...interface{}) Value {
-	cause := fmt.Sprintf(format, args...)
-	causePtr := C.CString(cause)
-	defer C.free(unsafe.Pointer(causePtr))
-	return Value{ctx: ctx, ref: C.ThrowSyntaxError(ctx.ref, causePtr)}
+	view, err := v.bufferView()
+	if err != nil {
+		return nil, err
+	}
+	return append([]byte{}, view...), nil
 }
 
-func (ctx *Context) ThrowTypeError(format string, args ...interface{}) Value {
-	cause := fmt.Sprintf(format, args...)
-	causePtr := C.CString(cause)
-	defer C.free(unsafe.Pointer(causePtr))
-	return Value{ctx: ctx, ref: C.ThrowTypeError(ctx.ref, causePtr)}
+// Detach detaches the ArrayBuffer v, releasing its contents. Typed arrays viewing v become empty, and reading from v
+// or them afterwards fails.
+func (v Value) Detach() error {
+	if C.JS_GetClassID(v.ref) != C.JS_CLASS_ID_ARRAY_BUFFER {
+		return errors.New("value is not an ArrayBuffer")
+	}
+	C.JS_DetachArrayBuffer(v.ctx.ref, v.ref)
+	return nil
 }
 
-func (ctx *Context) ThrowReferenceError(format string, args ...interface{}) Value {
-	cause := fmt.Sprintf(format, args...)
-	causePtr := C.CString(cause)
-	defer C.free(unsafe.Pointer(causePtr))
-	return Value{ctx: ctx, ref: C.ThrowReferenceError(ctx.ref, causePtr)}
-}
+// NumericStats returns the minimum, maximum, sum and count of the numbers within the array or typed array v. The
+// elements of typed arrays are read directly off of their backing buffer. An error is returned should v hold a
+// non-numeric element or be a BigInt typed array.
+func (v Value) NumericStats() (min, max, sum float64, count int, err error) {
+	at, n, err := v.numericElements()
+	if err != nil {
+		return 0, 0, 0, 0, err
+	}
 
-func (ctx *Context) ThrowRangeError(format string, args ...interface{}) Value {
-	cause := fmt.Sprintf(format, args...)
-	causePtr := C.CString(cause)
-	defer C.free(unsafe.Pointer(causePtr))
-	return Value{ctx: ctx, ref: C.ThrowRangeError(ctx.ref, causePtr)}
+	for i := 0; i < n; i++ {
+		x, err := at(i)
+		if err != nil {
+			return 0, 0, 0, 0, err
+		}
+		if i == 0 || x < min {
+			min = x
+		}
+		if i == 0 || x > max {
+			max = x
+		}
+		sum += x
+	}
+	return min, max, sum, n, nil
 }
 
-func (ctx *Context) ThrowInternalError(format string, args ...interface{}) Value {
-	cause := fmt.Sprintf(format, args...)
-	causePtr := C.CString(cause)
-	defer C.free(unsafe.Pointer(causePtr))
-	return Value{ctx: ctx, ref: C.ThrowInternalError(ctx.ref, causePtr)}
-}
+func (v Value) numericElements() (func(i int) (float64, error), int, error) {
+	if v.IsArray() {
+		return func(i int) (float64, error) {
+			item := v.GetByUint32(uint32(i))
+			defer item.Free()
+
+			if !item.IsNumber() {
+				return 0, fmt.Errorf("element %d is not a number", i)
+			}
+			return item.Float64(), nil
+		}, int(v.Len()), nil
+	}
 
-func (ctx *Context) Exception() error {
-	val := Value{ctx: ctx, ref: C.JS_GetException(ctx.ref)}
-	defer val.Free()
-	return val.Error()
-}
+	if !v.isTypedArray() {
+		return nil, 0, errors.New("value is not an array or typed array")
+	}
 
-func (ctx *Context) Object() Value {
-	return Value{ctx: ctx, ref: C.JS_NewObject(ctx.ref)}
-}
+	view, err := v.bufferView()
+	if err != nil {
+		return nil, 0, err
+	}
+	ptr := unsafe.Pointer(nil)
+	if len(view) > 0 {
+		ptr = unsafe.Pointer(&view[0])
+	}
 
-func (ctx *Context) Array() Value {
-	return Value{ctx: ctx, ref: C.JS_NewArray(ctx.ref)}
-}
+	switch C.JS_GetClassID(v.ref) {
+	case C.JS_CLASS_ID_INT8_ARRAY:
+		s := (*[1 << 30]int8)(ptr)[:len(view):len(view)]
+		return func(i int) (float64, error) { return float64(s[i]), nil }, len(s), nil
+	case C.JS_CLASS_ID_UINT8_ARRAY, C.JS_CLASS_ID_UINT8C_ARRAY:
+		return func(i int) (float64, error) { return float64(view[i]), nil }, len(view), nil
+	case C.JS_CLASS_ID_INT16_ARRAY:
+		s := (*[1 << 29]int16)(ptr)[: len(view)/2 : len(view)/2]
+		return func(i int) (float64, error) { return float64(s[i]), nil }, len(s), nil
+	case C.JS_CLASS_ID_UINT16_ARRAY:
+		s := (*[1 << 29]uint16)(ptr)[: len(view)/2 : len(view)/2]
+		return func(i int) (float64, error) { return float64(s[i]), nil }, len(s), nil
+	case C.JS_CLASS_ID_INT32_ARRAY:
+		s := (*[1 << 28]int32)(ptr)[: len(view)/4 : len(view)/4]
+		return func(i int) (float64, error) { return float64(s[i]), nil }, len(s), nil
+	case C.JS_CLASS_ID_UINT32_ARRAY:
+		s := (*[1 << 28]uint32)(ptr)[: len(view)/4 : len(view)/4]
+		return func(i int) (float64, error) { return float64(s[i]), nil }, len(s), nil
+	case C.JS_CLASS_ID_FLOAT32_ARRAY:
+		s := (*[1 << 28]float32)(ptr)[: len(view)/4 : len(view)/4]
+		return func(i int) (float64, error) { return float64(s[i]), nil }, len(s), nil
+	case C.JS_CLASS_ID_FLOAT64_ARRAY:
+		s := (*[1 << 27]float64)(ptr)[: len(view)/8 : len(view)/8]
+		return func(i int) (float64, error) { return s[i], nil }, len(s), nil
+	}
 
-type Atom struct {
-	ctx *Context
-	ref C.JSAtom
+	return nil, 0, errors.New("value is not a numeric typed array")
 }
 
-func (a Atom) Free() { C.JS_FreeAtom(a.ctx.ref, a.ref) }
+// ToBigInt64Slice returns a copy of the elements of the BigInt64Array v, read directly off its backing buffer.
+func (v Value) ToBigInt64Slice() ([]int64, error) {
+	if C.JS_GetClassID(v.ref) != C.JS_CLASS_ID_BIG_INT64_ARRAY {
+		return nil, errors.New("value is not a BigInt64Array")
+	}
 
-func (a Atom) String() string {
-	ptr := C.JS_AtomToCString(a.ctx.ref, a.ref)
-	defer C.JS_FreeCString(a.ctx.ref, ptr)
-	return C.GoString(ptr)
-}
+	view, err := v.bufferView()
+	if err != nil {
+		return nil, err
+	}
 
-func (a Atom) Value() Value {
-	return Value{ctx: a.ctx, ref: C.JS_AtomToValue(a.ctx.ref, a.ref)}
+	result := make([]int64, len(view)/8)
+	if len(result) > 0 {
+		copy(result, unsafe.Slice((*int64)(unsafe.Pointer(&view[0])), len(result)))
+	}
+	return result, nil
 }
 
-type Value struct {
-	ctx *Context
-	ref C.JSValue
-}
+const writeToChunkSize = 32 * 1024
 
-func (v Value) Free() { C.JS_FreeValue(v.ctx.ref, v.ref) }
+// WriteTo writes the bytes of the ArrayBuffer or typed array v to w, copying them out in chunks through a single
+// reusable buffer. w must not evaluate code within the runtime of v while being written to.
+func (v Value) WriteTo(w io.Writer) (int64, error) {
+	view, err := v.bufferView()
+	if err != nil {
+		return 0, err
+	}
 
-func (v Value) Context() *Context { return v.ctx }
+	chunk := make([]byte, writeToChunkSize)
+	if len(view) < len(chunk) {
+		chunk = chunk[:len(view)]
+	}
 
-func (v Value) Bool() bool { return C.JS_ToBool(v.ctx.ref, v.ref) == 1 }
+	var written int64
+	for len(view) > 0 {
+		n := copy(chunk, view)
+		view = view[n:]
 
-func (v Value) String() string {
-	ptr := C.JS_ToCString(v.ctx.ref, v.ref)
-	defer C.JS_FreeCString(v.ctx.ref, ptr)
-	return C.GoString(ptr)
+		m, err := w.Write(chunk[:n])
+		written += int64(m)
+		if err != nil {
+			return written, err
+		}
+		if m < n {
+			return written, io.ErrShortWrite
+		}
+	}
+	return written, nil
 }
 
-func (v Value) Int64() int64 {
-	val := C.int64_t(0)
-	C.JS_ToInt64(v.ctx.ref, &val, v.ref)
-	return int64(val)
-}
+// bufferView returns the bytes backing the ArrayBuffer or typed array v. The returned slice aliases memory owned by
+// the runtime, and must not be used after v has been freed.
+func (v Value) bufferView() ([]byte, error) {
+	var size C.size_t
 
-func (v Value) Int32() int32 {
-	val := C.int32_t(0)
-	C.JS_ToInt32(v.ctx.ref, &val, v.ref)
-	return int32(val)
+	if v.isArrayBuffer() {
+		ptr := C.JS_GetArrayBuffer(v.ctx.ref, &size, v.ref)
+		if ptr == nil {
+			return nil, v.ctx.Exception()
+		}
+		return (*[1 << 30]byte)(unsafe.Pointer(ptr))[:size:size], nil
+	}
+
+	if !v.isTypedArray() {
+		return nil, errors.New("value is not an ArrayBuffer or typed array")
+	}
+
+	var offset, length C.size_t
+
+	buf := Value{ctx: v.ctx, ref: C.JS_GetTypedArrayBuffer(v.ctx.ref, v.ref, &offset, &length, nil)}
+	if buf.IsException() {
+		return nil, v.ctx.Exception()
+	}
+	defer buf.Free()
+
+	ptr := C.JS_GetArrayBuffer(v.ctx.ref, &size, buf.ref)
+	if ptr == nil {
+		return nil, v.ctx.Exception()
+	}
+	return (*[1 << 30]byte)(unsafe.Pointer(ptr))[offset : offset+length : offset+length], nil
 }
 
-func (v Value) Uint32() uint32 {
-	val := C.uint32_t(0)
-	C.JS_ToUint32(v.ctx.ref, &val, v.ref)
-	return uint32(val)
+// isArrayBuffer reports whether v is an ArrayBuffer or a SharedArrayBuffer. As with the other class checks, the
+// class of v is consulted rather than its prototype chain, which scripts may spoof.
+func (v Value) isArrayBuffer() bool {
+	id := C.JS_GetClassID(v.ref)
+	return id == C.JS_CLASS_ID_ARRAY_BUFFER || id == C.JS_CLASS_ID_SHARED_ARRAY_BUFFER
 }
 
-func (v Value) Float64() float64 {
-	val := C.double(0)
-	C.JS_ToFloat64(v.ctx.ref, &val, v.ref)
-	return float64(val)
+func (v Value) isUint8Array() bool { return C.JS_GetClassID(v.ref) == C.JS_CLASS_ID_UINT8_ARRAY }
+
+func (v Value) isFloatArray() bool {
+	id := C.JS_GetClassID(v.ref)
+	return id == C.JS_CLASS_ID_FLOAT32_ARRAY || id == C.JS_CLASS_ID_FLOAT64_ARRAY
 }
 
-func (v Value) BigInt() *big.Int {
-	if !v.IsBigInt() {
-		return nil
-	}
-	val, ok := new(big.Int).SetString(v.String(), 10)
-	if !ok {
-		return nil
+// isTypedArray reports whether v is a typed array of any element type.
+func (v Value) isTypedArray() bool {
+	switch C.JS_GetClassID(v.ref) {
+	case C.JS_CLASS_ID_UINT8C_ARRAY, C.JS_CLASS_ID_INT8_ARRAY, C.JS_CLASS_ID_UINT8_ARRAY,
+		C.JS_CLASS_ID_INT16_ARRAY, C.JS_CLASS_ID_UINT16_ARRAY, C.JS_CLASS_ID_INT32_ARRAY, C.JS_CLASS_ID_UINT32_ARRAY,
+		C.JS_CLASS_ID_BIG_INT64_ARRAY, C.JS_CLASS_ID_BIG_UINT64_ARRAY,
+		C.JS_CLASS_ID_FLOAT32_ARRAY, C.JS_CLASS_ID_FLOAT64_ARRAY:
+		return true
 	}
-	return val
+	return false
 }
 
-func (v Value) BigFloat() *big.Float {
-	if !v.IsBigDecimal() && !v.IsBigFloat() {
-		return nil
-	}
-	val, ok := new(big.Float).SetString(v.String())
-	if !ok {
-		return nil
+// IsInstanceOf reports whether v is an instance of ctor, as with the instanceof operator. false is returned should
+// ctor not be a constructor, or should the check throw.
+func (v Value) IsInstanceOf(ctor Value) bool {
+	result := C.JS_IsInstanceOf(v.ctx.ref, v.ref, ctor.ref)
+	if result < 0 {
+		v.ctx.Exception()
 	}
-	return val
+	return result == 1
 }
 
 func (v Value) Get(name string) Value {
+	v.ctx.runtime.checkThread()
+
 	namePtr := C.CString(name)
 	defer C.free(unsafe.Pointer(namePtr))
 	return Value{ctx: v.ctx, ref: C.JS_GetPropertyStr(v.ctx.ref, v.ref, namePtr)}
@@ -403,45 +2873,179 @@ func (v Value) SetByUint32(idx uint32, val Value) {
 	C.JS_SetPropertyUint32(v.ctx.ref, v.ref, C.uint32_t(idx), val.ref)
 }
 
+func (v Value) SetInt64At(idx int64, val int64) {
+	C.JS_SetPropertyInt64(v.ctx.ref, v.ref, C.int64_t(idx), C.JS_NewInt64(v.ctx.ref, C.int64_t(val)))
+}
+
+func (v Value) SetFloat64At(idx int64, val float64) {
+	C.JS_SetPropertyInt64(v.ctx.ref, v.ref, C.int64_t(idx), C.JS_NewFloat64(v.ctx.ref, C.double(val)))
+}
+
 func (v Value) Len() int64 { return v.Get("length").Int64() }
 
+// SetLength sets the length of the array v to n, truncating it or extending it with holes. An error is returned
+// should v not be an array, should n not be a valid array length, or should the array be frozen.
+func (v Value) SetLength(n int64) error {
+	if !v.IsArray() {
+		return errors.New("value is not an array")
+	}
+
+	namePtr := C.CString("length")
+	defer C.free(unsafe.Pointer(namePtr))
+
+	if C.JS_SetPropertyStr(v.ctx.ref, v.ref, namePtr, v.ctx.Int64(n).ref) < 0 {
+		return v.ctx.Exception()
+	}
+	return nil
+}
+
+// Reduce calls fn for each item of the array-like value v in order, threading through an accumulator that starts
+// off as initial. Reduce takes ownership of initial and of each accumulator returned by fn, freeing the previous
+// accumulator once fn returns a different value. fn may return acc itself to carry it over, in which case it must
+// not dup it. Should fn return an error, both the accumulator and the value fn returned (if any) are freed.
+func (v Value) Reduce(initial Value, fn func(acc, item Value, idx int) (Value, error)) (Value, error) {
+	if !v.IsArrayLike() {
+		initial.Free()
+		return v.ctx.Undefined(), errors.New("value is not array-like")
+	}
+
+	acc := initial
+	for i, n := 0, v.Len(); int64(i) < n; i++ {
+		item := v.GetByUint32(uint32(i))
+		next, err := fn(acc, item, i)
+		item.Free()
+
+		same := next.ctx != nil && C.ValueIdentical(next.ref, acc.ref) == 1
+		if err != nil {
+			acc.Free()
+			if next.ctx != nil && !same {
+				next.Free()
+			}
+			return v.ctx.Undefined(), err
+		}
+
+		if !same {
+			acc.Free()
+		}
+		acc = next
+	}
+	return acc, nil
+}
+
 func (v Value) Set(name string, val Value) {
+	v.ctx.runtime.checkThread()
+
 	namePtr := C.CString(name)
 	defer C.free(unsafe.Pointer(namePtr))
 	C.JS_SetPropertyStr(v.ctx.ref, v.ref, namePtr, val.ref)
 }
 
+// SetConst defines a property named name on v that may neither be reassigned nor reconfigured.
+func (v Value) SetConst(name string, val Value) {
+	namePtr := C.CString(name)
+	defer C.free(unsafe.Pointer(namePtr))
+	C.JS_DefinePropertyValueStr(v.ctx.ref, v.ref, namePtr, val.ref, C.JS_PROP_ENUMERABLE)
+}
+
+// SetFunction sets the property of v with the given name to a function backed by fn. Calls to the function are
+// counted under name once the profiler of the context is enabled.
 func (v Value) SetFunction(name string, fn Function) {
-	v.Set(name, v.ctx.Function(fn))
+	v.Set(name, v.ctx.Function(func(ctx *Context, this Value, args []Value) Value {
+		ctx.countCall(name)
+		return fn(ctx, this, args)
+	}))
 }
 
 type Error struct {
 	Cause string
 	Stack string
+
+	// Properties holds the own enumerable properties of the error object, such as a custom error code.
+	Properties map[string]string
+
+	format ErrorFormatter
 }
 
-func (err Error) Error() string { return err.Cause }
+// ErrorFormatter formats an error thrown within a runtime into the message returned by its Error method.
+type ErrorFormatter func(err Error) string
+
+func (err Error) Error() string {
+	if err.format != nil {
+		return err.format(err)
+	}
+	return err.Cause
+}
+
+// Format returns the cause of the error, followed by its stack trace on a new line should includeStack be true.
+func (err Error) Format(includeStack bool) string {
+	if !includeStack || err.Stack == "" {
+		return err.Cause
+	}
+	return err.Cause + "\n" + strings.TrimRight(err.Stack, "\n")
+}
 
 func (v Value) Error() error {
 	if !v.IsError() {
 		return nil
 	}
-	cause := v.String()
+	err := &Error{Cause: v.String(), format: v.ctx.runtime.formatError}
 
 	stack := v.Get("stack")
 	defer stack.Free()
 
-	if stack.IsUndefined() {
-		return &Error{Cause: cause}
+	if !stack.IsUndefined() {
+		err.Stack = stack.String()
+	}
+
+	names, _ := v.PropertyNamesWith(PropertyNamesOwnOnly)
+	for _, name := range names {
+		if val, ok := v.errorProperty(name.Atom); ok {
+			if err.Properties == nil {
+				err.Properties = make(map[string]string, len(names))
+			}
+			err.Properties[name.String()] = val
+		}
+	}
+
+	return err
+}
+
+// errorProperty returns the own property of the error v with the given name as a string on behalf of Error. As
+// errors are converted while an exception is being handled, no script code may run: accessors, and values whose
+// conversion into a string could run code or fail (objects and symbols), are skipped.
+func (v Value) errorProperty(name Atom) (string, bool) {
+	var desc C.JSPropertyDescriptor
+
+	ret := C.JS_GetOwnProperty(v.ctx.ref, &desc, v.ref, name.ref)
+	if ret < 0 {
+		v.ctx.Exception()
+		return "", false
+	}
+	if ret == 0 {
+		return "", false
+	}
+
+	val := Value{ctx: v.ctx, ref: desc.value}
+	defer val.Free()
+	defer C.JS_FreeValue(v.ctx.ref, desc.getter)
+	defer C.JS_FreeValue(v.ctx.ref, desc.setter)
+
+	if desc.flags&C.JS_PROP_GETSET != 0 || val.IsObject() || val.IsSymbol() {
+		return "", false
 	}
-	return &Error{Cause: cause, Stack: stack.String()}
+	return val.String(), true
 }
 
-func (v Value) IsNumber() bool        { return C.JS_IsNumber(v.ref) == 1 }
-func (v Value) IsBigInt() bool        { return C.JS_IsBigInt(v.ctx.ref, v.ref) == 1 }
-func (v Value) IsBigFloat() bool      { return C.JS_IsBigFloat(v.ref) == 1 }
-func (v Value) IsBigDecimal() bool    { return C.JS_IsBigDecimal(v.ref) == 1 }
-func (v Value) IsBool() bool          { return C.JS_IsBool(v.ref) == 1 }
+func (v Value) IsNumber() bool     { return C.JS_IsNumber(v.ref) == 1 }
+func (v Value) IsBigInt() bool     { return C.JS_IsBigInt(v.ctx.ref, v.ref) == 1 }
+func (v Value) IsBigFloat() bool   { return C.JS_IsBigFloat(v.ref) == 1 }
+func (v Value) IsBigDecimal() bool { return C.JS_IsBigDecimal(v.ref) == 1 }
+func (v Value) IsBool() bool       { return C.JS_IsBool(v.ref) == 1 }
+
+// NeedsFree reports whether v is reference-counted and must be freed. Numbers, booleans, null and undefined do not
+// need to be freed, while objects, strings, symbols and big numbers do.
+func (v Value) NeedsFree() bool { return C.ValueHasRefCount(v.ref) == 1 }
+
 func (v Value) IsNull() bool          { return C.JS_IsNull(v.ref) == 1 }
 func (v Value) IsUndefined() bool     { return C.JS_IsUndefined(v.ref) == 1 }
 func (v Value) IsException() bool     { return C.JS_IsException(v.ref) == 1 }
@@ -455,6 +3059,66 @@ func (v Value) IsError() bool       { return C.JS_IsError(v.ctx.ref, v.ref) == 1
 func (v Value) IsFunction() bool    { return C.JS_IsFunction(v.ctx.ref, v.ref) == 1 }
 func (v Value) IsConstructor() bool { return C.JS_IsConstructor(v.ctx.ref, v.ref) == 1 }
 
+// IsCallable is an alias of IsFunction. Both report whether v may be called, i.e. whether typeof v is "function".
+// Besides ordinary functions, this includes classes, bound functions, functions created through Context.Function,
+// and proxies of callable targets, whose apply trap is invoked should they have one. A proxy of a non-callable
+// target is not callable, even should it have an apply trap.
+func (v Value) IsCallable() bool { return v.IsFunction() }
+
+// IsNativeFunction reports whether v is a function backed by Go that was created through Context.Function.
+func (v Value) IsNativeFunction() bool {
+	if !v.IsFunction() || v.ctx.natives == nil {
+		return false
+	}
+
+	has := v.ctx.natives.Get("has")
+	defer has.Free()
+
+	result := v.ctx.call(has, *v.ctx.natives, v)
+	defer result.Free()
+
+	return result.Bool()
+}
+
+// IsDate reports whether v is a Date object, judged by its class rather than its prototype chain, such that neither
+// Dates from other realms nor objects spoofing Date.prototype are misjudged.
+func (v Value) IsDate() bool { return C.JS_GetClassID(v.ref) == C.JS_CLASS_ID_DATE }
+
+// IsRegExp reports whether v is a RegExp object, judged by its class as with IsDate.
+func (v Value) IsRegExp() bool { return C.JS_GetClassID(v.ref) == C.JS_CLASS_ID_REGEXP }
+
+func (v Value) IsArrayLike() bool {
+	if !v.IsObject() || v.IsFunction() {
+		return false
+	}
+
+	length := v.Get("length")
+	defer length.Free()
+
+	if !length.IsNumber() {
+		return false
+	}
+
+	n := length.Float64()
+	return n >= 0 && n <= maxSafeInteger && n == math.Trunc(n)
+}
+
+// IsEmpty reports whether v is null, undefined, an empty string, an empty array, or an object other than a function
+// with no own enumerable properties.
+func (v Value) IsEmpty() bool {
+	switch {
+	case v.IsNull(), v.IsUndefined():
+		return true
+	case v.IsString():
+		return v.Len() == 0
+	case v.IsArray():
+		return v.Len() == 0
+	case v.IsObject() && !v.IsFunction():
+		return v.PropertyCount() == 0
+	}
+	return false
+}
+
 type PropertyEnum struct {
 	IsEnumerable bool
 	Atom         Atom
@@ -463,12 +3127,114 @@ type PropertyEnum struct {
 func (p PropertyEnum) String() string { return p.Atom.String() }
 
 func (v Value) PropertyNames() ([]PropertyEnum, error) {
+	return v.ownPropertyNames(C.int(1<<0 | 1<<1 | 1<<2))
+}
+
+type PropertyNameFlags int
+
+const (
+	// PropertyNamesSymbols includes symbol-keyed properties.
+	PropertyNamesSymbols PropertyNameFlags = 1 << iota
+	// PropertyNamesNonEnumerable includes properties that are not enumerable.
+	PropertyNamesNonEnumerable
+	// PropertyNamesOwnOnly excludes properties inherited through the prototype chain.
+	PropertyNamesOwnOnly
+)
+
+func (v Value) PropertyNamesWith(flags PropertyNameFlags) ([]PropertyEnum, error) {
+	gpn := C.int(C.JS_GPN_STRING_MASK | C.JS_GPN_SET_ENUM)
+	if flags&PropertyNamesSymbols != 0 {
+		gpn |= C.JS_GPN_SYMBOL_MASK
+	}
+	if flags&PropertyNamesNonEnumerable == 0 {
+		gpn |= C.JS_GPN_ENUM_ONLY
+	}
+
+	names, err := v.ownPropertyNames(gpn)
+	if err != nil || flags&PropertyNamesOwnOnly != 0 {
+		return names, err
+	}
+
+	seen := make(map[C.JSAtom]struct{}, len(names))
+	for _, name := range names {
+		seen[name.Atom.ref] = struct{}{}
+	}
+
+	proto := Value{ctx: v.ctx, ref: C.JS_GetPrototype(v.ctx.ref, v.ref)}
+	for proto.IsObject() {
+		inherited, err := proto.ownPropertyNames(gpn)
+		if err != nil {
+			proto.Free()
+			return nil, err
+		}
+
+		for _, name := range inherited {
+			if _, exists := seen[name.Atom.ref]; exists {
+				continue
+			}
+			seen[name.Atom.ref] = struct{}{}
+			names = append(names, name)
+		}
+
+		next := Value{ctx: v.ctx, ref: C.JS_GetPrototype(v.ctx.ref, proto.ref)}
+		proto.Free()
+		proto = next
+	}
+	if proto.IsException() {
+		return nil, v.ctx.Exception()
+	}
+
+	return names, nil
+}
+
+// OwnPropertySymbols returns the symbols keying v's own properties. The returned values must be freed by the
+// caller.
+func (v Value) OwnPropertySymbols() ([]Value, error) {
+	names, err := v.ownPropertyNames(C.JS_GPN_SYMBOL_MASK)
+	if err != nil {
+		return nil, err
+	}
+
+	symbols := make([]Value, len(names))
+	for i, name := range names {
+		symbols[i] = name.Atom.Value()
+	}
+	return symbols, nil
+}
+
+// PropertyCount returns the number of own enumerable properties of v, keyed either by strings or symbols, or zero
+// should v not be an object. Paired with a memory limit, it may be used after evaluation to reject values that grew
+// too large.
+func (v Value) PropertyCount() int {
+	if !v.IsObject() {
+		return 0
+	}
+
+	var (
+		ptr  *C.JSPropertyEnum
+		size C.uint32_t
+	)
+
+	if C.JS_GetOwnPropertyNames(v.ctx.ref, &ptr, &size, v.ref, C.JS_GPN_STRING_MASK|C.JS_GPN_SYMBOL_MASK|C.JS_GPN_ENUM_ONLY) < 0 {
+		return 0
+	}
+
+	entries := (*[1 << 30]C.JSPropertyEnum)(unsafe.Pointer(ptr))[:size:size]
+	for _, entry := range entries {
+		C.JS_FreeAtom(v.ctx.ref, entry.atom)
+	}
+	C.js_free(v.ctx.ref, unsafe.Pointer(ptr))
+
+	return int(size)
+}
+
+func (v Value) ownPropertyNames(flags C.int) ([]PropertyEnum, error) {
 	var (
 		ptr  *C.JSPropertyEnum
 		size C.uint32_t
 	)
 
-	result := int(C.JS_GetOwnPropertyNames(v.ctx.ref, &ptr, &size, v.ref, C.int(1<<0|1<<1|1<<2)))
+	result := int(C.JS_GetOwnPropertyNames(v.ctx.ref, &ptr, &size, v.ref, flags))
 	if result < 0 {
 		return nil, errors.New("value does not contain properties")
 	}
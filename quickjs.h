@@ -712,6 +712,7 @@ JS_BOOL JS_IsConstructor(JSContext* ctx, JSValueConst val);
 JS_BOOL JS_SetConstructorBit(JSContext *ctx, JSValueConst func_obj, JS_BOOL val);
 
 JSValue JS_NewArray(JSContext *ctx);
+JSValue JS_NewArrayWithCapacity(JSContext *ctx, uint32_t len);
 int JS_IsArray(JSContext *ctx, JSValueConst val);
 
 JSValue JS_GetPropertyInternal(JSContext *ctx, JSValueConst obj,
@@ -792,6 +793,24 @@ int JS_DefinePropertyGetSet(JSContext *ctx, JSValueConst this_obj,
 void JS_SetOpaque(JSValue obj, void *opaque);
 void *JS_GetOpaque(JSValueConst obj, JSClassID class_id);
 void *JS_GetOpaque2(JSContext *ctx, JSValueConst obj, JSClassID class_id);
+JSClassID JS_GetClassID(JSValueConst obj);
+extern const JSClassID JS_CLASS_ID_DATE;
+extern const JSClassID JS_CLASS_ID_REGEXP;
+extern const JSClassID JS_CLASS_ID_ARRAY_BUFFER;
+extern const JSClassID JS_CLASS_ID_SHARED_ARRAY_BUFFER;
+extern const JSClassID JS_CLASS_ID_UINT8C_ARRAY;
+extern const JSClassID JS_CLASS_ID_INT8_ARRAY;
+extern const JSClassID JS_CLASS_ID_UINT8_ARRAY;
+extern const JSClassID JS_CLASS_ID_INT16_ARRAY;
+extern const JSClassID JS_CLASS_ID_UINT16_ARRAY;
+extern const JSClassID JS_CLASS_ID_INT32_ARRAY;
+extern const JSClassID JS_CLASS_ID_UINT32_ARRAY;
+extern const JSClassID JS_CLASS_ID_BIG_INT64_ARRAY;
+extern const JSClassID JS_CLASS_ID_BIG_UINT64_ARRAY;
+extern const JSClassID JS_CLASS_ID_FLOAT32_ARRAY;
+extern const JSClassID JS_CLASS_ID_FLOAT64_ARRAY;
+JSValue JS_NewDate(JSContext *ctx, double ms);
+JSValue JS_NewUint8Array(JSContext *ctx, JSValueConst buffer);
 
 /* 'buf' must be zero terminated i.e. buf[buf_len] = '\0'. */
 JSValue JS_ParseJSON(JSContext *ctx, const char *buf, size_t buf_len,
@@ -822,7 +841,15 @@ typedef struct {
 void JS_SetSharedArrayBufferFunctions(JSRuntime *rt,
                                       const JSSharedArrayBufferFunctions *sf);
 
+typedef enum JSPromiseStateEnum {
+    JS_PROMISE_PENDING,
+    JS_PROMISE_FULFILLED,
+    JS_PROMISE_REJECTED,
+} JSPromiseStateEnum;
+
 JSValue JS_NewPromiseCapability(JSContext *ctx, JSValue *resolving_funcs);
+JSPromiseStateEnum JS_PromiseState(JSContext *ctx, JSValueConst promise);
+JSValue JS_PromiseResult(JSContext *ctx, JSValueConst promise);
 
 /* is_handled = TRUE means that the rejection is handled */
 typedef void JSHostPromiseRejectionTracker(JSContext *ctx, JSValueConst promise,
@@ -853,6 +880,11 @@ void JS_SetModuleLoaderFunc(JSRuntime *rt,
                             JSModuleLoaderFunc *module_loader, void *opaque);
 /* return the import.meta object of a module */
 JSValue JS_GetImportMeta(JSContext *ctx, JSModuleDef *m);
+/* return the namespace object of an evaluated module */
+JSValue JS_GetModuleNamespace(JSContext *ctx, JSModuleDef *m);
+JSValue JS_NewAggregateError(JSContext *ctx, JSValueConst errors,
+                             const char *message, size_t len);
+int JS_DeleteGlobalBinding(JSContext *ctx, JSAtom prop);
 JSAtom JS_GetModuleName(JSContext *ctx, JSModuleDef *m);
 
 /* JS Job support */
@@ -1,12 +1,27 @@
 package quickjs
 
 import (
+	"bytes"
+	stdcontext "context"
+	"embed"
 	"errors"
 	"fmt"
 	"github.com/stretchr/testify/require"
+	"io"
+	"io/ioutil"
+	"math"
+	"math/big"
+	"os"
+	"path"
+	"path/filepath"
+	"reflect"
+	"regexp"
 	stdruntime "runtime"
+	"strings"
 	"sync"
 	"testing"
+	"time"
+	"unsafe"
 )
 
 func TestObject(t *testing.T) {
@@ -53,6 +68,46 @@ func TestArray(t *testing.T) {
 	require.EqualValues(t, `TEST 0,TEST 1,TEST 2`, result.String())
 }
 
+func TestStringEmbeddedNUL(t *testing.T) {
+	runtime := NewRuntime()
+	defer runtime.Free()
+
+	context := runtime.NewContext()
+	defer context.Free()
+
+	context.Globals().Set("nul", context.String("a\x00b"))
+
+	result, err := context.Eval(`nul.length === 3 && nul.charCodeAt(1) === 0`)
+	require.NoError(t, err)
+	defer result.Free()
+	require.True(t, result.Bool())
+
+	result, err = context.Eval(`"x\0y\0"`)
+	require.NoError(t, err)
+	defer result.Free()
+	require.EqualValues(t, "x\x00y\x00", result.String())
+}
+
+func TestStringInvalidUTF8(t *testing.T) {
+	runtime := NewRuntime()
+	defer runtime.Free()
+
+	context := runtime.NewContext()
+	defer context.Free()
+
+	context.Globals().Set("invalid", context.String("a\xffb"))
+
+	result, err := context.Eval(`invalid.length === 3 && invalid.charCodeAt(1) === 0xfffd`)
+	require.NoError(t, err)
+	defer result.Free()
+	require.True(t, result.Bool())
+
+	result, err = context.Eval(`invalid`)
+	require.NoError(t, err)
+	defer result.Free()
+	require.EqualValues(t, "a\uFFFDb", result.String())
+}
+
 func TestBadSyntax(t *testing.T) {
 	runtime := NewRuntime()
 	defer runtime.Free()
@@ -171,3 +226,3475 @@ func TestConcurrency(t *testing.T) {
 		<-res
 	}
 }
+
+func TestIsArrayLike(t *testing.T) {
+	runtime := NewRuntime()
+	defer runtime.Free()
+
+	context := runtime.NewContext()
+	defer context.Free()
+
+	array, err := context.Eval(`[1, 2, 3]`)
+	require.NoError(t, err)
+	defer array.Free()
+
+	arguments, err := context.Eval(`(function() { return arguments; })(1, 2)`)
+	require.NoError(t, err)
+	defer arguments.Free()
+
+	arrayLike, err := context.Eval(`({length: 2, 0: "a", 1: "b"})`)
+	require.NoError(t, err)
+	defer arrayLike.Free()
+
+	object, err := context.Eval(`({a: 1})`)
+	require.NoError(t, err)
+	defer object.Free()
+
+	require.True(t, array.IsArray() && array.IsArrayLike())
+	require.True(t, !arguments.IsArray() && arguments.IsArrayLike())
+	require.True(t, !arrayLike.IsArray() && arrayLike.IsArrayLike())
+	require.False(t, object.IsArrayLike())
+}
+
+func TestCompileScript(t *testing.T) {
+	runtime := NewRuntime()
+	defer runtime.Free()
+
+	context := runtime.NewContext()
+	defer context.Free()
+
+	script, err := context.CompileScript(`greeting + ", " + name + "!"`, "greet.js")
+	require.NoError(t, err)
+	defer script.Close()
+
+	for _, name := range []string{"Alice", "Bob", "Carol"} {
+		context.Globals().Set("greeting", context.String("Hello"))
+		context.Globals().Set("name", context.String(name))
+
+		result, err := script.Run()
+		require.NoError(t, err)
+
+		require.EqualValues(t, "Hello, "+name+"!", result.String())
+		result.Free()
+	}
+
+	_, err = context.CompileScript(`"bad syntax'`, "bad.js")
+	require.Error(t, err)
+
+	closed, err := context.CompileScript(`1`, "closed.js")
+	require.NoError(t, err)
+
+	closed.Close()
+	closed.Close()
+
+	_, err = closed.Run()
+	require.True(t, errors.Is(err, ErrScriptClosed))
+}
+
+func TestPropertyNamesWith(t *testing.T) {
+	runtime := NewRuntime()
+	defer runtime.Free()
+
+	context := runtime.NewContext()
+	defer context.Free()
+
+	object, err := context.Eval(`
+		const parent = {inherited: 1};
+		const child = Object.create(parent);
+		child.own = 2;
+		child[Symbol("tag")] = 3;
+		Object.defineProperty(child, "hidden", {value: 4, enumerable: false});
+		child;
+	`)
+	require.NoError(t, err)
+	defer object.Free()
+
+	collect := func(flags PropertyNameFlags) []string {
+		names, err := object.PropertyNamesWith(flags)
+		require.NoError(t, err)
+
+		keys := make([]string, 0, len(names))
+		for _, name := range names {
+			keys = append(keys, name.String())
+		}
+		return keys
+	}
+
+	require.ElementsMatch(t, []string{"own"}, collect(PropertyNamesOwnOnly))
+	require.ElementsMatch(t, []string{"own", "inherited"}, collect(0))
+	require.ElementsMatch(t, []string{"own", "tag"}, collect(PropertyNamesOwnOnly|PropertyNamesSymbols))
+	require.ElementsMatch(t, []string{"own", "hidden"}, collect(PropertyNamesOwnOnly|PropertyNamesNonEnumerable))
+}
+
+func TestSource(t *testing.T) {
+	runtime := NewRuntime()
+	defer runtime.Free()
+
+	context := runtime.NewContext()
+	defer context.Free()
+
+	fn, err := context.Eval(`(function add(a, b) { return a + b; })`)
+	require.NoError(t, err)
+	defer fn.Free()
+
+	source, ok := fn.Source()
+	require.True(t, ok)
+	require.EqualValues(t, `function add(a, b) { return a + b; }`, source)
+
+	native, err := context.Eval(`Math.max`)
+	require.NoError(t, err)
+	defer native.Free()
+
+	source, ok = native.Source()
+	require.True(t, ok)
+	require.Contains(t, source, "[native code]")
+
+	_, ok = context.Globals().Source()
+	require.False(t, ok)
+}
+
+func TestPrototypeChain(t *testing.T) {
+	runtime := NewRuntime()
+	defer runtime.Free()
+
+	context := runtime.NewContext()
+	defer context.Free()
+
+	instance, err := context.Eval(`class Animal {}; class Dog extends Animal {}; new Dog()`)
+	require.NoError(t, err)
+	defer instance.Free()
+
+	chain, err := instance.PrototypeChain()
+	require.NoError(t, err)
+	defer func() {
+		for _, proto := range chain {
+			proto.Free()
+		}
+	}()
+
+	require.Len(t, chain, 3)
+
+	for i, name := range []string{"Dog", "Animal", "Object"} {
+		constructor := chain[i].Get("constructor")
+		require.EqualValues(t, name, constructor.Get("name").String())
+		constructor.Free()
+	}
+}
+
+func TestAsyncIterableFromChannel(t *testing.T) {
+	runtime := NewRuntime()
+	defer runtime.Free()
+
+	context := runtime.NewContext()
+	defer context.Free()
+
+	ch := make(chan Value, 3)
+	ch <- context.String("a")
+	ch <- context.String("b")
+	ch <- context.String("c")
+	close(ch)
+
+	context.Globals().Set("it", context.AsyncIterableFromChannel(ch))
+
+	result, err := context.Eval(`(async () => {
+		const items = [];
+		for await (const x of it) items.push(x);
+		output = items.join(",");
+	})()`)
+	require.NoError(t, err)
+	defer result.Free()
+
+	for {
+		_, err := runtime.ExecutePendingJob()
+		if err == io.EOF {
+			break
+		}
+		require.NoError(t, err)
+	}
+
+	output := context.Globals().Get("output")
+	defer output.Free()
+
+	require.EqualValues(t, "a,b,c", output.String())
+}
+
+func TestJSONStringifyLimit(t *testing.T) {
+	runtime := NewRuntime()
+	defer runtime.Free()
+
+	context := runtime.NewContext()
+	defer context.Free()
+
+	large, err := context.Eval(`Array.from({length: 1000}, (_, i) => ({id: i, name: "item " + i}))`)
+	require.NoError(t, err)
+	defer large.Free()
+
+	json, truncated, err := large.JSONStringifyLimit(64)
+	require.NoError(t, err)
+	require.True(t, truncated)
+	require.Len(t, json, 64)
+	require.EqualValues(t, `[{"id":0,"name":"item 0"},{"id":1,"name":"item 1"},{"id":2,"name`, json)
+
+	small, err := context.Eval(`({a: 1})`)
+	require.NoError(t, err)
+	defer small.Free()
+
+	json, truncated, err = small.JSONStringifyLimit(64)
+	require.NoError(t, err)
+	require.False(t, truncated)
+	require.EqualValues(t, `{"a":1}`, json)
+
+	unicode, err := context.Eval(`"héllo"`)
+	require.NoError(t, err)
+	defer unicode.Free()
+
+	json, truncated, err = unicode.JSONStringifyLimit(3)
+	require.NoError(t, err)
+	require.True(t, truncated)
+	require.EqualValues(t, `"h`, json)
+
+	json, truncated, err = unicode.JSONStringifyLimit(4)
+	require.NoError(t, err)
+	require.True(t, truncated)
+	require.EqualValues(t, `"hé`, json)
+
+	cyclic, err := context.Eval(`const cyclic = {}; cyclic.self = cyclic; cyclic`)
+	require.NoError(t, err)
+	defer cyclic.Free()
+
+	_, _, err = cyclic.JSONStringifyLimit(64)
+	require.Error(t, err)
+
+	_, _, err = small.JSONStringifyLimit(-1)
+	require.EqualError(t, err, "maxBytes must not be negative")
+
+	mixed, err := context.Eval(`({
+		list: [1, -2.5, NaN, Infinity, null, true, false, undefined, () => {}, "ünïcödé", { nested: [[]] }],
+		skipped: undefined,
+		date: new Date(0),
+		"quoted \"key\"": "line\nbreak",
+	})`)
+	require.NoError(t, err)
+	defer mixed.Free()
+
+	full, err := mixed.JSON()
+	require.NoError(t, err)
+
+	for limit := 0; limit <= len(full)+1; limit++ {
+		json, truncated, err := mixed.JSONStringifyLimit(limit)
+		require.NoError(t, err)
+		require.EqualValues(t, limit < len(full), truncated, limit)
+		require.True(t, strings.HasPrefix(full, json), limit)
+		if !truncated {
+			require.EqualValues(t, full, json)
+		}
+	}
+
+	visits, err := context.Eval(`
+		globalThis.visits = 0;
+		Array.from({length: 100000}, () => ({ get value() { visits++; return "x".repeat(100); } }))
+	`)
+	require.NoError(t, err)
+	defer visits.Free()
+
+	_, truncated, err = visits.JSONStringifyLimit(1024)
+	require.NoError(t, err)
+	require.True(t, truncated)
+
+	count, err := context.Eval(`visits`)
+	require.NoError(t, err)
+	require.Less(t, count.Int32(), int32(20))
+}
+
+func TestBytecodeHeader(t *testing.T) {
+	runtime := NewRuntime()
+	defer runtime.Free()
+
+	a := runtime.NewContext()
+	defer a.Free()
+
+	b := runtime.NewContext()
+	defer b.Free()
+
+	buf, err := a.Compile(`[1, 2, 3].map(x => x * 2).join(",")`, "double.js")
+	require.NoError(t, err)
+
+	result, err := b.EvalBytecode(buf)
+	require.NoError(t, err)
+	defer result.Free()
+
+	require.EqualValues(t, "2,4,6", result.String())
+
+	tampered := append([]byte(nil), buf...)
+	tampered[len("quickjs ")] ^= 0xff
+
+	_, err = b.EvalBytecode(tampered)
+	require.True(t, errors.Is(err, ErrBytecodeVersionMismatch))
+
+	_, err = b.EvalBytecode(buf[:4])
+	require.True(t, errors.Is(err, ErrBytecodeVersionMismatch))
+
+	other := NewRuntime()
+	defer other.Free()
+
+	c := other.NewContext()
+	defer c.Free()
+
+	result, err = c.EvalBytecode(buf)
+	require.NoError(t, err)
+	defer result.Free()
+
+	require.EqualValues(t, "2,4,6", result.String())
+}
+
+func TestSetConst(t *testing.T) {
+	runtime := NewRuntime()
+	defer runtime.Free()
+
+	context := runtime.NewContext()
+	defer context.Free()
+
+	config := context.Object()
+	config.SetConst("version", context.Int32(1))
+	context.Globals().Set("config", config)
+
+	_, err := context.Eval(`"use strict"; config.version = 2;`)
+	require.Error(t, err)
+
+	_, err = context.Eval(`"use strict"; delete config.version;`)
+	require.Error(t, err)
+
+	result, err := context.Eval(`config.version`)
+	require.NoError(t, err)
+	defer result.Free()
+
+	require.EqualValues(t, 1, result.Int32())
+}
+
+func TestSandbox(t *testing.T) {
+	runtime := NewRuntime()
+	defer runtime.Free()
+
+	context := runtime.NewContext()
+	defer context.Free()
+
+	context.Globals().Set("allowed", context.Int32(42))
+
+	require.NoError(t, context.Sandbox())
+
+	for _, code := range []string{
+		`eval("1")`,
+		`new Function("return 1")`,
+		`Function("return 1")`,
+		`(function() {}).constructor("return 1")`,
+		`(async function() {}).constructor("return 1")`,
+		`(function*() {}).constructor("return 1")`,
+	} {
+		_, err := context.Eval(code)
+		require.Error(t, err, code)
+	}
+
+	_, err := context.Eval(`"use strict"; polluted = true;`)
+	require.Error(t, err)
+
+	result, err := context.Eval(`allowed + 1`)
+	require.NoError(t, err)
+	defer result.Free()
+
+	require.EqualValues(t, 43, result.Int32())
+}
+
+func TestBase64AndHexBytes(t *testing.T) {
+	runtime := NewRuntime()
+	defer runtime.Free()
+
+	context := runtime.NewContext()
+	defer context.Free()
+
+	encoded := context.String("aGVsbG8gd29ybGQ=")
+	defer encoded.Free()
+
+	decoded, err := encoded.Base64Bytes()
+	require.NoError(t, err)
+	require.EqualValues(t, "hello world", decoded)
+
+	encoded = context.String("deadbeef")
+	defer encoded.Free()
+
+	decoded, err = encoded.HexBytes()
+	require.NoError(t, err)
+	require.EqualValues(t, []byte{0xde, 0xad, 0xbe, 0xef}, decoded)
+
+	_, err = context.Int32(1).HexBytes()
+	require.Error(t, err)
+
+	invalid := context.String("not hex")
+	defer invalid.Free()
+
+	_, err = invalid.HexBytes()
+	require.Error(t, err)
+}
+
+func TestEvalWithGlobals(t *testing.T) {
+	runtime := NewRuntime()
+	defer runtime.Free()
+
+	context := runtime.NewContext()
+	defer context.Free()
+
+	result, err := context.EvalWithGlobals("`Hello, ${name}! ${typeof parseInt}`", map[string]Value{
+		"name":     context.String("world"),
+		"parseInt": context.String("shadowed"),
+	})
+	require.NoError(t, err)
+	defer result.Free()
+
+	require.EqualValues(t, "Hello, world! string", result.String())
+
+	result, err = context.Eval(`typeof name + " " + typeof parseInt`)
+	require.NoError(t, err)
+	defer result.Free()
+
+	require.EqualValues(t, "undefined function", result.String())
+
+	result, err = context.Eval(`
+		var assigned = [];
+		Object.defineProperty(globalThis, "accessor", { get: () => "original", set: (v) => assigned.push(v), configurable: true });
+		Object.defineProperty(globalThis, "fixed", { value: "original", writable: false, configurable: true });
+	`)
+	require.NoError(t, err)
+	result.Free()
+
+	result, err = context.EvalWithGlobals(`accessor + "," + fixed`, map[string]Value{
+		"accessor": context.String("injected"),
+		"fixed":    context.String("injected"),
+	})
+	require.NoError(t, err)
+	defer result.Free()
+	require.EqualValues(t, "injected,injected", result.String())
+
+	result, err = context.Eval(`[accessor, fixed, assigned.length, Object.getOwnPropertyDescriptor(globalThis, "fixed").writable].join(",")`)
+	require.NoError(t, err)
+	defer result.Free()
+	require.EqualValues(t, "original,original,0,false", result.String())
+
+	_, err = context.EvalWithGlobals(`NaN`, map[string]Value{"NaN": context.Int32(1)})
+	require.EqualError(t, err, "global NaN is not configurable and cannot be shadowed")
+}
+
+func TestRunFile(t *testing.T) {
+	runtime := NewRuntime()
+	defer runtime.Free()
+
+	context := runtime.NewContext()
+	defer context.Free()
+
+	dir, err := ioutil.TempDir("", "quickjs")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	script := filepath.Join(dir, "script.js")
+	require.NoError(t, ioutil.WriteFile(script, []byte(`const answer = 6 * 7; answer`), 0644))
+
+	result, err := context.RunFile(script)
+	require.NoError(t, err)
+	defer result.Free()
+
+	require.EqualValues(t, 42, result.Int32())
+
+	module := filepath.Join(dir, "module.mjs")
+	require.NoError(t, ioutil.WriteFile(module, []byte(`export const x = 1; globalThis.fromModule = x + 1;`), 0644))
+
+	result, err = context.RunFile(module)
+	require.NoError(t, err)
+	defer result.Free()
+
+	result, err = context.Eval(`fromModule`)
+	require.NoError(t, err)
+	defer result.Free()
+
+	require.EqualValues(t, 2, result.Int32())
+
+	broken := filepath.Join(dir, "broken.js")
+	require.NoError(t, ioutil.WriteFile(broken, []byte(`throw new Error("broken")`), 0644))
+
+	_, err = context.RunFile(broken)
+	require.Error(t, err)
+
+	var evalErr *Error
+	require.True(t, errors.As(err, &evalErr))
+	require.Contains(t, evalErr.Stack, "broken.js")
+	require.NotContains(t, evalErr.Stack, dir)
+
+	_, err = context.RunFile(filepath.Join(dir, "missing.js"))
+	require.True(t, os.IsNotExist(err))
+}
+
+func executePendingJobs(t *testing.T, runtime Runtime) {
+	for {
+		_, err := runtime.ExecutePendingJob()
+		if err == io.EOF {
+			return
+		}
+		require.NoError(t, err)
+	}
+}
+
+func TestDynamicImport(t *testing.T) {
+	runtime := NewRuntime()
+	defer runtime.Free()
+
+	runtime.SetModuleLoader(nil, func(moduleName string) ([]byte, error) {
+		if moduleName != "foo" {
+			return nil, fmt.Errorf("module not found")
+		}
+		return []byte(`export const value = "from foo";`), nil
+	})
+
+	context := runtime.NewContext()
+	defer context.Free()
+
+	result, err := context.Eval(`import("foo").then(m => { value = m.value; })`)
+	require.NoError(t, err)
+	defer result.Free()
+
+	result, err = context.Eval(`import("bar").catch(err => { failure = err.message; })`)
+	require.NoError(t, err)
+	defer result.Free()
+
+	executePendingJobs(t, runtime)
+
+	value := context.Globals().Get("value")
+	defer value.Free()
+
+	require.EqualValues(t, "from foo", value.String())
+
+	failure := context.Globals().Get("failure")
+	defer failure.Free()
+
+	require.EqualValues(t, "could not load module 'bar': module not found", failure.String())
+}
+
+func TestNativeModule(t *testing.T) {
+	runtime := NewRuntime()
+	defer runtime.Free()
+
+	runtime.RegisterNativeModule("native:math", func(ctx *Context) map[string]Value {
+		return map[string]Value{
+			"add": ctx.Function(func(ctx *Context, this Value, args []Value) Value {
+				return ctx.Int64(args[0].Int64() + args[1].Int64())
+			}),
+			"half": ctx.Float64(0.5),
+		}
+	})
+
+	context := runtime.NewContext()
+	defer context.Free()
+
+	result, err := context.EvalModule(`import { add, half } from "native:math"; globalThis.sum = add(1, 2) + half;`, "main.mjs")
+	require.NoError(t, err)
+	defer result.Free()
+
+	sum := context.Globals().Get("sum")
+	defer sum.Free()
+
+	require.EqualValues(t, 3.5, sum.Float64())
+
+	result, err = context.Eval(`import("native:other").catch(err => { failure = err.message; })`)
+	require.NoError(t, err)
+	defer result.Free()
+
+	executePendingJobs(t, runtime)
+
+	failure := context.Globals().Get("failure")
+	defer failure.Free()
+
+	require.EqualValues(t, "could not load module 'native:other': no module loader set", failure.String())
+}
+
+func TestReduce(t *testing.T) {
+	runtime := NewRuntime()
+	defer runtime.Free()
+
+	context := runtime.NewContext()
+	defer context.Free()
+
+	array, err := context.Eval(`[1, 2, 3]`)
+	require.NoError(t, err)
+	defer array.Free()
+
+	sum, err := array.Reduce(context.Int64(0), func(acc, item Value, idx int) (Value, error) {
+		return context.Int64(acc.Int64() + item.Int64()), nil
+	})
+	require.NoError(t, err)
+	defer sum.Free()
+
+	require.EqualValues(t, 6, sum.Int64())
+
+	squares, err := array.Reduce(context.Array(), func(acc, item Value, idx int) (Value, error) {
+		acc.SetByInt64(int64(idx), context.Int64(item.Int64()*item.Int64()))
+		return acc, nil
+	})
+	require.NoError(t, err)
+	defer squares.Free()
+
+	require.EqualValues(t, "1,4,9", squares.String())
+
+	expected := errors.New("stop")
+
+	_, err = array.Reduce(context.Object(), func(acc, item Value, idx int) (Value, error) {
+		return acc, expected
+	})
+	require.True(t, errors.Is(err, expected))
+
+	_, err = array.Reduce(context.Object(), func(acc, item Value, idx int) (Value, error) {
+		return Value{}, expected
+	})
+	require.True(t, errors.Is(err, expected))
+
+	_, err = array.Reduce(context.Object(), func(acc, item Value, idx int) (Value, error) {
+		return context.Object(), expected
+	})
+	require.True(t, errors.Is(err, expected))
+
+	_, err = context.Int32(1).Reduce(context.Int64(0), nil)
+	require.Error(t, err)
+}
+
+func TestConstructorName(t *testing.T) {
+	runtime := NewRuntime()
+	defer runtime.Free()
+
+	context := runtime.NewContext()
+	defer context.Free()
+
+	for code, expected := range map[string]string{
+		`[]`:                                  "Array",
+		`({})`:                                "Object",
+		`class Point {}; new Point()`:         "Point",
+		`Object.create(null)`:                 "",
+		`null`:                                "",
+		`"text"`:                              "String",
+		`new Map()`:                           "Map",
+		`new (class extends Error {})`:        "",
+		`new (class Custom extends Error {})`: "Custom",
+	} {
+		val, err := context.Eval(code)
+		require.NoError(t, err)
+
+		require.EqualValues(t, expected, val.ConstructorName(), code)
+		val.Free()
+	}
+}
+
+func TestEvalExpr(t *testing.T) {
+	runtime := NewRuntime()
+	defer runtime.Free()
+
+	context := runtime.NewContext()
+	defer context.Free()
+
+	result, err := context.EvalExpr(`{a: 1} // an object literal`)
+	require.NoError(t, err)
+	defer result.Free()
+
+	require.True(t, result.IsObject())
+
+	a := result.Get("a")
+	defer a.Free()
+
+	require.EqualValues(t, 1, a.Int32())
+
+	_, err = context.EvalExpr(`1; 2`)
+	require.Error(t, err)
+
+	_, err = context.EvalExpr(`1); globalThis.leaked = true; (2`)
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "SyntaxError")
+
+	leaked, err := context.Eval(`typeof leaked`)
+	require.NoError(t, err)
+	defer leaked.Free()
+	require.EqualValues(t, "undefined", leaked.String())
+
+	sequence, err := context.EvalExpr(`1, 2`)
+	require.NoError(t, err)
+	defer sequence.Free()
+	require.EqualValues(t, 2, sequence.Int32())
+
+	_, err = context.EvalExpr(`...[1]`)
+	require.Error(t, err)
+}
+
+func TestSetNumberAt(t *testing.T) {
+	runtime := NewRuntime()
+	defer runtime.Free()
+
+	context := runtime.NewContext()
+	defer context.Free()
+
+	test := context.Array()
+	test.SetInt64At(0, 1)
+	test.SetInt64At(1, 1<<40)
+	test.SetFloat64At(2, 0.5)
+	context.Globals().Set("test", test)
+
+	result, err := context.Eval(`test.length === 3 && test[0] === 1 && test[1] === 2 ** 40 && test[2] === 0.5`)
+	require.NoError(t, err)
+	defer result.Free()
+
+	require.True(t, result.Bool())
+}
+
+func BenchmarkSetInt64At(b *testing.B) {
+	runtime := NewRuntime()
+	defer runtime.Free()
+
+	context := runtime.NewContext()
+	defer context.Free()
+
+	test := context.Array()
+	defer test.Free()
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		test.SetInt64At(int64(i%1024), int64(i))
+	}
+}
+
+func BenchmarkSetByInt64(b *testing.B) {
+	runtime := NewRuntime()
+	defer runtime.Free()
+
+	context := runtime.NewContext()
+	defer context.Free()
+
+	test := context.Array()
+	defer test.Free()
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		test.SetByInt64(int64(i%1024), context.Int64(int64(i)))
+	}
+}
+
+func TestThreadCheck(t *testing.T) {
+	stdruntime.LockOSThread()
+	defer stdruntime.UnlockOSThread()
+
+	runtime := NewRuntime()
+	defer runtime.Free()
+
+	runtime.SetThreadCheck(true)
+
+	context := runtime.NewContext()
+	defer context.Free()
+
+	result, err := context.Eval(`1 + 1`)
+	require.NoError(t, err)
+	defer result.Free()
+
+	panicked := make(chan interface{})
+	go func() {
+		stdruntime.LockOSThread()
+		defer stdruntime.UnlockOSThread()
+
+		defer func() { panicked <- recover() }()
+		context.Eval(`1 + 1`)
+	}()
+
+	require.Contains(t, fmt.Sprint(<-panicked), "os thread other than the one it was created on")
+}
+
+func TestErrorProperties(t *testing.T) {
+	runtime := NewRuntime()
+	defer runtime.Free()
+
+	context := runtime.NewContext()
+	defer context.Free()
+
+	_, err := context.Eval(`throw Object.assign(new Error("x"), {code: "E1", status: 404})`)
+	require.Error(t, err)
+
+	var evalErr *Error
+	require.True(t, errors.As(err, &evalErr))
+	require.EqualValues(t, "Error: x", evalErr.Cause)
+	require.EqualValues(t, map[string]string{"code": "E1", "status": "404"}, evalErr.Properties)
+
+	_, err = context.Eval(`throw new Error("plain")`)
+	require.True(t, errors.As(err, &evalErr))
+	require.Nil(t, evalErr.Properties)
+
+	_, err = context.Eval(`
+		const err = new Error("hostile");
+		Object.defineProperty(err, "code", { get() { throw new Error("getter ran"); }, enumerable: true });
+		err.tag = Symbol("tag");
+		err.nested = { toString() { throw new Error("toString ran"); } };
+		err.status = 500;
+		throw err;
+	`)
+	require.True(t, errors.As(err, &evalErr))
+	require.EqualValues(t, "Error: hostile", evalErr.Cause)
+	require.EqualValues(t, map[string]string{"status": "500"}, evalErr.Properties)
+
+	result, err := context.Eval(`"still usable"`)
+	require.NoError(t, err)
+	defer result.Free()
+	require.EqualValues(t, "still usable", result.String())
+}
+
+func TestRunFullGC(t *testing.T) {
+	runtime := NewRuntime()
+	defer runtime.Free()
+
+	context := runtime.NewContext()
+	defer context.Free()
+
+	runtime.RunFullGC()
+	baseline := runtime.MemoryUsage().ObjCount
+
+	result, err := context.Eval(`(() => {
+		for (let i = 0; i < 1000; i++) {
+			const a = {};
+			const b = {a};
+			a.b = b;
+		}
+	})()`)
+	require.NoError(t, err)
+	result.Free()
+
+	runtime.RunFullGC()
+	require.LessOrEqual(t, runtime.MemoryUsage().ObjCount, baseline)
+}
+
+func TestArrayWithCapacity(t *testing.T) {
+	runtime := NewRuntime()
+	defer runtime.Free()
+
+	context := runtime.NewContext()
+	defer context.Free()
+
+	test := context.ArrayWithCapacity(3)
+	require.True(t, test.IsArray())
+	require.EqualValues(t, 3, test.Len())
+
+	for i := int64(0); i < test.Len(); i++ {
+		test.SetInt64At(i, i*10)
+	}
+	context.Globals().Set("test", test)
+
+	result, err := context.Eval(`test.length === 3 && test.join(",")`)
+	require.NoError(t, err)
+	defer result.Free()
+
+	require.EqualValues(t, "0,10,20", result.String())
+
+	before := runtime.MemoryUsage().MallocSize
+	reserved := context.ArrayWithCapacity(1000)
+	defer reserved.Free()
+	require.GreaterOrEqual(t, runtime.MemoryUsage().MallocSize-before, int64(1000*8))
+
+	invalid := context.ArrayWithCapacity(-1)
+	require.True(t, invalid.IsException())
+	require.EqualError(t, context.Exception(), "RangeError: invalid array length -1")
+}
+
+func benchmarkArray(b *testing.B, build func(ctx *Context, n int) Value) {
+	runtime := NewRuntime()
+	defer runtime.Free()
+
+	context := runtime.NewContext()
+	defer context.Free()
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		arr := build(context, 100000)
+		for j := 0; j < 100000; j++ {
+			arr.SetInt64At(int64(j), int64(j))
+		}
+		arr.Free()
+	}
+}
+
+func BenchmarkArray(b *testing.B) {
+	benchmarkArray(b, func(ctx *Context, n int) Value { return ctx.Array() })
+}
+
+func BenchmarkArrayWithCapacity(b *testing.B) {
+	benchmarkArray(b, func(ctx *Context, n int) Value { return ctx.ArrayWithCapacity(n) })
+}
+
+func TestToJSONValue(t *testing.T) {
+	runtime := NewRuntime()
+	defer runtime.Free()
+
+	context := runtime.NewContext()
+	defer context.Free()
+
+	money, err := context.Eval(`({amount: 1050, currency: "USD", toJSON() { return {display: (this.amount / 100).toFixed(2) + " " + this.currency}; }})`)
+	require.NoError(t, err)
+	defer money.Free()
+
+	plain, err := money.ToJSONValue()
+	require.NoError(t, err)
+	defer plain.Free()
+
+	display := plain.Get("display")
+	defer display.Free()
+
+	require.EqualValues(t, "10.50 USD", display.String())
+
+	object, err := context.Eval(`({a: 1})`)
+	require.NoError(t, err)
+	defer object.Free()
+
+	same, err := object.ToJSONValue()
+	require.NoError(t, err)
+	defer same.Free()
+
+	a := same.Get("a")
+	defer a.Free()
+
+	require.EqualValues(t, 1, a.Int32())
+
+	throws, err := context.Eval(`({toJSON() { throw new Error("nope"); }})`)
+	require.NoError(t, err)
+	defer throws.Free()
+
+	_, err = throws.ToJSONValue()
+	require.Error(t, err)
+}
+
+func TestEvalIsolatedGlobals(t *testing.T) {
+	runtime := NewRuntime()
+	defer runtime.Free()
+
+	context := runtime.NewContext()
+	defer context.Free()
+
+	context.Globals().Set("secret", context.String("hunter2"))
+
+	result, err := context.EvalWithOptions(`leaked = true; ({secret: typeof secret, double: x => x * 2, list: [1, 2]})`, EvalOptions{IsolatedGlobals: true})
+	require.NoError(t, err)
+	require.NotSame(t, context, result.Context())
+	context.Globals().Set("isolated", result)
+
+	result, err = context.Eval(`[isolated.secret, typeof leaked, isolated.double(21), typeof secret, Array.isArray(isolated.list), isolated.list instanceof Array].join(",")`)
+	require.NoError(t, err)
+	defer result.Free()
+
+	require.EqualValues(t, "undefined,undefined,42,string,true,false", result.String())
+
+	_, err = context.EvalWithOptions(`secret.length`, EvalOptions{IsolatedGlobals: true})
+	require.Error(t, err)
+
+	realms := len(context.realms)
+	for i := 0; i < 100; i++ {
+		result, err := context.EvalWithOptions(`[1, 2, 3].length`, EvalOptions{IsolatedGlobals: true})
+		require.NoError(t, err)
+		require.EqualValues(t, 3, result.Int32())
+		result.Free()
+	}
+	require.Len(t, context.realms, realms)
+
+	object, err := context.EvalWithOptions(`({ answer: 42 })`, EvalOptions{IsolatedGlobals: true})
+	require.NoError(t, err)
+	require.Len(t, context.realms, realms+1)
+	require.EqualValues(t, 42, GetOr(object, "answer", 0))
+
+	object.Free()
+	object.Context().Free()
+	require.Len(t, context.realms, realms)
+}
+
+func TestIsDateAndIsRegExp(t *testing.T) {
+	runtime := NewRuntime()
+	defer runtime.Free()
+
+	context := runtime.NewContext()
+	defer context.Free()
+
+	date, err := context.Eval(`new Date()`)
+	require.NoError(t, err)
+	defer date.Free()
+
+	regexp, err := context.Eval(`/x/`)
+	require.NoError(t, err)
+	defer regexp.Free()
+
+	object, err := context.Eval(`({})`)
+	require.NoError(t, err)
+	defer object.Free()
+
+	require.True(t, date.IsDate())
+	require.False(t, date.IsRegExp())
+
+	require.True(t, regexp.IsRegExp())
+	require.False(t, regexp.IsDate())
+
+	require.False(t, object.IsDate())
+	require.False(t, object.IsRegExp())
+
+	require.False(t, context.Float64(0).IsDate())
+
+	spoofed, err := context.Eval(`[Object.create(Date.prototype), Object.setPrototypeOf(/x/, null)]`)
+	require.NoError(t, err)
+	defer spoofed.Free()
+
+	fake, stripped := spoofed.GetByUint32(0), spoofed.GetByUint32(1)
+	defer fake.Free()
+	defer stripped.Free()
+
+	require.False(t, fake.IsDate())
+	require.True(t, stripped.IsRegExp())
+}
+
+func TestSourceTransform(t *testing.T) {
+	runtime := NewRuntime()
+	defer runtime.Free()
+
+	context := runtime.NewContext()
+	defer context.Free()
+
+	annotations := regexp.MustCompile(`:\s*number\b`)
+
+	context.SetSourceTransform(func(code, filename string) (string, error) {
+		if strings.HasSuffix(filename, ".bad") {
+			return "", errors.New("cannot transform")
+		}
+		return annotations.ReplaceAllString(code, ""), nil
+	})
+
+	result, err := context.Eval(`function add(a: number, b: number): number { return a + b; } add(1, 2)`)
+	require.NoError(t, err)
+	defer result.Free()
+
+	require.EqualValues(t, 3, result.Int32())
+
+	result, err = context.EvalModule(`const x: number = 1; globalThis.fromModule = x;`, "module.ts")
+	require.NoError(t, err)
+	defer result.Free()
+
+	_, err = context.EvalFile(`1`, "script.bad")
+	require.EqualError(t, err, "cannot transform")
+
+	context.SetSourceTransform(nil)
+
+	_, err = context.Eval(`const y: number = 1;`)
+	require.Error(t, err)
+}
+
+func TestOwnPropertySymbols(t *testing.T) {
+	runtime := NewRuntime()
+	defer runtime.Free()
+
+	context := runtime.NewContext()
+	defer context.Free()
+
+	object, err := context.Eval(`tag = Symbol("tag"); ({[tag]: "tagged", plain: "plain"})`)
+	require.NoError(t, err)
+	defer object.Free()
+
+	symbols, err := object.OwnPropertySymbols()
+	require.NoError(t, err)
+	require.Len(t, symbols, 1)
+	defer symbols[0].Free()
+
+	require.True(t, symbols[0].IsSymbol())
+
+	context.Globals().Set("found", symbols[0].Dup())
+
+	result, err := context.Eval(`found === tag`)
+	require.NoError(t, err)
+	defer result.Free()
+
+	require.True(t, result.Bool())
+}
+
+func TestCallDeadline(t *testing.T) {
+	runtime := NewRuntime()
+	defer runtime.Free()
+
+	context := runtime.NewContext()
+	defer context.Free()
+
+	fn, err := context.Eval(`() => { while (true) {} }`)
+	require.NoError(t, err)
+	defer fn.Free()
+
+	context.SetDeadline(time.Now().Add(50 * time.Millisecond))
+
+	result, err := fn.Call(context.Undefined())
+	require.True(t, errors.Is(err, stdcontext.DeadlineExceeded))
+	result.Free()
+
+	context.SetDeadline(time.Time{})
+
+	result, err = context.EvalWithTimeout(`1 + 2`, time.Second)
+	require.NoError(t, err)
+	require.EqualValues(t, 3, result.Int32())
+	result.Free()
+
+	result, err = context.EvalWithTimeout(`while (true) {}`, 50*time.Millisecond)
+	require.True(t, errors.Is(err, stdcontext.DeadlineExceeded))
+	result.Free()
+}
+
+func TestArithmetic(t *testing.T) {
+	runtime := NewRuntime()
+	defer runtime.Free()
+
+	context := runtime.NewContext()
+	defer context.Free()
+
+	a := context.BigUint64(1 << 62)
+	defer a.Free()
+
+	b := context.BigUint64(1 << 62)
+	defer b.Free()
+
+	sum, err := a.Add(b)
+	require.NoError(t, err)
+	defer sum.Free()
+
+	require.True(t, sum.IsBigInt())
+	require.EqualValues(t, "9223372036854775808", sum.String())
+
+	num := context.Int32(1)
+	defer num.Free()
+
+	str := context.String("2")
+	defer str.Free()
+
+	concat, err := num.Add(str)
+	require.NoError(t, err)
+	defer concat.Free()
+
+	require.EqualValues(t, "12", concat.String())
+
+	quotient, err := context.Float64(7).Div(context.Float64(2))
+	require.NoError(t, err)
+	require.EqualValues(t, 3.5, quotient.Float64())
+
+	_, err = a.Mul(num)
+	require.Error(t, err)
+
+	require.Len(t, context.operators, 4)
+	cached := context.operators[opSub]
+
+	for i := 0; i < 100; i++ {
+		diff, err := context.Int32(int32(i)).Sub(num)
+		require.NoError(t, err)
+		require.EqualValues(t, i-1, diff.Int32())
+	}
+	require.Equal(t, cached, context.operators[opSub])
+}
+
+func TestCachedString(t *testing.T) {
+	runtime := NewRuntime()
+	defer runtime.Free()
+
+	context := runtime.NewContext()
+	defer context.Free()
+
+	val := context.String("config value")
+	defer val.Free()
+
+	// Every conversion allocates a new Go string, so that strings sharing their backing memory were memoized.
+	data := func(s string) uintptr { return (*reflect.StringHeader)(unsafe.Pointer(&s)).Data }
+
+	first := val.CachedString()
+	for i := 0; i < 1000; i++ {
+		str := val.CachedString()
+		require.EqualValues(t, "config value", str)
+		require.Equal(t, data(first), data(str))
+	}
+	require.NotEqual(t, data(first), data(val.String()))
+
+	obj, err := context.Eval(`({ n: 0, toString() { return String(this.n++); } })`)
+	require.NoError(t, err)
+	defer obj.Free()
+
+	require.EqualValues(t, "0", obj.CachedString())
+	require.EqualValues(t, "1", obj.CachedString())
+}
+
+func TestCallRaw(t *testing.T) {
+	runtime := NewRuntime()
+	defer runtime.Free()
+
+	context := runtime.NewContext()
+	defer context.Free()
+
+	fn, err := context.Eval(`(code) => { if (code) throw { code, reason: "custom" }; return "ok"; }`)
+	require.NoError(t, err)
+	defer fn.Free()
+
+	result, thrown, ok := fn.CallRaw(context.Undefined(), context.Int32(0))
+	require.True(t, ok)
+	require.True(t, thrown.IsUndefined())
+	require.EqualValues(t, "ok", result.String())
+	result.Free()
+
+	result, thrown, ok = fn.CallRaw(context.Undefined(), context.Int32(42))
+	require.False(t, ok)
+	require.True(t, result.IsUndefined())
+	defer thrown.Free()
+
+	code := thrown.Get("code")
+	defer code.Free()
+
+	reason := thrown.Get("reason")
+	defer reason.Free()
+
+	require.EqualValues(t, 42, code.Int32())
+	require.EqualValues(t, "custom", reason.String())
+}
+
+func TestPropertyCount(t *testing.T) {
+	runtime := NewRuntime()
+	defer runtime.Free()
+
+	context := runtime.NewContext()
+	defer context.Free()
+
+	obj, err := context.Eval(`const obj = { a: 1, b: 2, [Symbol("c")]: 3 }; Object.defineProperty(obj, "hidden", { value: 4 }); obj`)
+	require.NoError(t, err)
+	defer obj.Free()
+
+	require.EqualValues(t, 3, obj.PropertyCount())
+
+	str := context.String("abc")
+	defer str.Free()
+
+	require.EqualValues(t, 0, str.PropertyCount())
+}
+
+func TestIsEmpty(t *testing.T) {
+	runtime := NewRuntime()
+	defer runtime.Free()
+
+	context := runtime.NewContext()
+	defer context.Free()
+
+	tests := map[string]bool{
+		`null`:      true,
+		`undefined`: true,
+		`""`:        true,
+		`[]`:        true,
+		`({})`:      true,
+		`Object.defineProperty({}, "hidden", { value: 1 })`: true,
+		`"a"`:         false,
+		`[undefined]`: false,
+		`({ a: 1 })`:  false,
+		`0`:           false,
+		`false`:       false,
+		`(() => {})`:  false,
+	}
+
+	for code, empty := range tests {
+		val, err := context.Eval(code)
+		require.NoError(t, err)
+		require.EqualValues(t, empty, val.IsEmpty(), code)
+		val.Free()
+	}
+}
+
+func TestSnapshotGlobals(t *testing.T) {
+	runtime := NewRuntime()
+	defer runtime.Free()
+
+	context := runtime.NewContext()
+	defer context.Free()
+
+	before, err := context.Eval(`Reflect.ownKeys(globalThis).map(String).sort().join(",")`)
+	require.NoError(t, err)
+	defer before.Free()
+
+	snapshot, err := context.SnapshotGlobals()
+	require.NoError(t, err)
+	defer snapshot.Free()
+
+	result, err := context.Eval(`
+		polluted = true;
+		var leaked = 1;
+		function helper() {}
+		delete globalThis.JSON;
+		Math = null;
+		Object.defineProperty(globalThis, "locked", { value: 1, configurable: true });
+	`)
+	require.NoError(t, err)
+	result.Free()
+
+	require.NoError(t, context.RestoreGlobals(snapshot))
+
+	after, err := context.Eval(`Reflect.ownKeys(globalThis).map(String).sort().join(",")`)
+	require.NoError(t, err)
+	defer after.Free()
+
+	require.EqualValues(t, before.String(), after.String())
+
+	result, err = context.Eval(`typeof polluted === "undefined" && typeof leaked === "undefined" && typeof helper === "undefined" && JSON.stringify([1]) === "[1]" && Math.max(1, 2) === 2`)
+	require.NoError(t, err)
+	defer result.Free()
+
+	require.True(t, result.Bool())
+
+	result, err = context.Eval(`var leaked = 2; leaked`)
+	require.NoError(t, err)
+	defer result.Free()
+	require.EqualValues(t, 2, result.Int32())
+}
+
+func TestNeedsFree(t *testing.T) {
+	runtime := NewRuntime()
+	defer runtime.Free()
+
+	context := runtime.NewContext()
+	defer context.Free()
+
+	require.False(t, context.Float64(1.5).NeedsFree())
+	require.False(t, context.Int32(1).NeedsFree())
+	require.False(t, context.Bool(true).NeedsFree())
+	require.False(t, context.Null().NeedsFree())
+	require.False(t, context.Undefined().NeedsFree())
+
+	obj := context.Object()
+	defer obj.Free()
+
+	require.True(t, obj.NeedsFree())
+
+	str := context.String("hello")
+	defer str.Free()
+
+	require.True(t, str.NeedsFree())
+}
+
+//go:embed testdata
+var testdata embed.FS
+
+func TestEvalModuleReader(t *testing.T) {
+	runtime := NewRuntime()
+	defer runtime.Free()
+
+	context := runtime.NewContext()
+	defer context.Free()
+
+	f, err := testdata.Open("testdata/greet.mjs")
+	require.NoError(t, err)
+	defer f.Close()
+
+	result, err := context.EvalModuleReader(f, "greet.mjs")
+	require.NoError(t, err)
+	defer result.Free()
+
+	greeting := context.Globals().Get("greeting")
+	defer greeting.Free()
+
+	require.EqualValues(t, "Hello, embed!", greeting.String())
+
+	result, err = context.EvalReader(strings.NewReader(`greeting.length`), "length.js")
+	require.NoError(t, err)
+	defer result.Free()
+
+	require.EqualValues(t, 13, result.Int32())
+}
+
+func TestWriteTo(t *testing.T) {
+	runtime := NewRuntime()
+	defer runtime.Free()
+
+	context := runtime.NewContext()
+	defer context.Free()
+
+	arr, err := context.Eval(`const arr = new Uint8Array(64 * 1024); for (let i = 0; i < arr.length; i++) arr[i] = i * 7; arr`)
+	require.NoError(t, err)
+	defer arr.Free()
+
+	expected := make([]byte, 64*1024)
+	for i := range expected {
+		expected[i] = byte(i * 7)
+	}
+
+	var buf bytes.Buffer
+
+	n, err := arr.WriteTo(&buf)
+	require.NoError(t, err)
+	require.EqualValues(t, len(expected), n)
+	require.Equal(t, expected, buf.Bytes())
+
+	obj := context.Object()
+	defer obj.Free()
+
+	_, err = obj.WriteTo(&buf)
+	require.Error(t, err)
+}
+
+func TestArrayBufferFromReader(t *testing.T) {
+	runtime := NewRuntime()
+	defer runtime.Free()
+
+	context := runtime.NewContext()
+	defer context.Free()
+
+	buf, err := context.ArrayBufferFromReader(strings.NewReader("hello"))
+	require.NoError(t, err)
+
+	context.Globals().Set("buf", buf)
+
+	result, err := context.Eval(`buf instanceof ArrayBuffer && buf.byteLength === 5 && String.fromCharCode(...new Uint8Array(buf)) === "hello"`)
+	require.NoError(t, err)
+	defer result.Free()
+
+	require.True(t, result.Bool())
+}
+
+func TestMemoryLimit(t *testing.T) {
+	runtime := NewRuntime()
+	defer runtime.Free()
+
+	runtime.SetMemoryLimit(4 * 1024 * 1024)
+
+	context := runtime.NewContext()
+	defer context.Free()
+
+	result, err := context.Eval(`const chunks = []; for (;;) chunks.push(new Array(100000).fill(0));`)
+	defer result.Free()
+
+	var jsErr *Error
+	require.True(t, errors.As(err, &jsErr))
+	require.EqualValues(t, "InternalError: out of memory", jsErr.Cause)
+
+	result, err = context.Eval(`chunks.length = 0; "recovered"`)
+	require.NoError(t, err)
+	defer result.Free()
+
+	require.EqualValues(t, "recovered", result.String())
+}
+
+func TestThrowNonError(t *testing.T) {
+	runtime := NewRuntime()
+	defer runtime.Free()
+
+	context := runtime.NewContext()
+	defer context.Free()
+
+	result, err := context.Eval(`throw "boom"`)
+	defer result.Free()
+
+	require.EqualError(t, err, "boom")
+}
+
+func TestMaxStackSize(t *testing.T) {
+	runtime := NewRuntime()
+	defer runtime.Free()
+
+	context := runtime.NewContext()
+	defer context.Free()
+
+	recurse := func() {
+		result, err := context.Eval(`function f() { return f(); } f()`)
+		defer result.Free()
+
+		var jsErr *Error
+		require.True(t, errors.As(err, &jsErr))
+		require.EqualValues(t, "RangeError: stack overflow", jsErr.Cause)
+	}
+
+	recurse()
+
+	runtime.SetMaxStackSize(DefaultMaxStackSize * 4)
+	recurse()
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+
+		stdruntime.LockOSThread()
+		defer stdruntime.UnlockOSThread()
+
+		recurse()
+	}()
+	<-done
+
+	result, err := context.Eval(`function depth(n) { return n === 0 ? 0 : 1 + depth(n - 1); } depth(1000)`)
+	require.NoError(t, err)
+	defer result.Free()
+
+	require.EqualValues(t, 1000, result.Int32())
+}
+
+func TestLazyObject(t *testing.T) {
+	runtime := NewRuntime()
+	defer runtime.Free()
+
+	context := runtime.NewContext()
+	defer context.Free()
+
+	calls := make(map[string]int)
+	getter := func(key string) (Value, bool) {
+		calls[key]++
+		if key != "a" && key != "b" && key != "c" {
+			return Value{}, false
+		}
+		return context.String("value of " + key), true
+	}
+
+	context.Globals().Set("config", context.LazyObject(getter))
+
+	result, err := context.Eval(`[config.a, config.a, "a" in config, config.missing, "missing" in config].join(",")`)
+	require.NoError(t, err)
+	defer result.Free()
+
+	require.EqualValues(t, "value of a,value of a,true,,false", result.String())
+	require.EqualValues(t, map[string]int{"a": 1, "missing": 1}, calls)
+
+	context.Globals().Set("keyed", context.LazyObjectWithKeys(getter, func() []string { return []string{"b", "c"} }))
+
+	result, err = context.Eval(`JSON.stringify(keyed)`)
+	require.NoError(t, err)
+	defer result.Free()
+
+	require.EqualValues(t, `{"b":"value of b","c":"value of c"}`, result.String())
+	require.EqualValues(t, 1, calls["b"])
+	require.EqualValues(t, 1, calls["c"])
+}
+
+func TestClone(t *testing.T) {
+	runtime := NewRuntime()
+	defer runtime.Free()
+
+	context := runtime.NewContext()
+	defer context.Free()
+
+	context.SetGlobalFunction("double", func(ctx *Context, this Value, args []Value) Value {
+		return ctx.Int64(args[0].Int64() * 2)
+	})
+
+	settings := context.Object()
+	settings.Set("factor", context.Int32(3))
+	context.SetGlobal("settings", settings)
+
+	result, err := context.Eval(`unrecorded = true`)
+	require.NoError(t, err)
+	result.Free()
+
+	clone, err := context.Clone()
+	require.NoError(t, err)
+	defer clone.Free()
+
+	result, err = clone.Eval(`double(21) + settings.factor`)
+	require.NoError(t, err)
+	defer result.Free()
+
+	require.EqualValues(t, 45, result.Int64())
+
+	result, err = clone.Eval(`typeof unrecorded`)
+	require.NoError(t, err)
+	defer result.Free()
+
+	require.EqualValues(t, "undefined", result.String())
+}
+
+func TestInterruptHandler(t *testing.T) {
+	runtime := NewRuntime()
+	defer runtime.Free()
+
+	context := runtime.NewContext()
+	defer context.Free()
+
+	calls := 0
+	runtime.SetInterruptHandler(func() bool {
+		calls++
+		return calls == 3
+	})
+
+	result, err := context.Eval(`while (true) {}`)
+	defer result.Free()
+
+	var interrupted *InterruptedError
+	require.True(t, errors.As(err, &interrupted))
+	require.Nil(t, interrupted.Cause)
+	require.EqualValues(t, 3, calls)
+
+	runtime.SetInterruptHandler(nil)
+
+	result, err = context.Eval(`let i = 0; while (i < 1e6) i++; i`)
+	require.NoError(t, err)
+	defer result.Free()
+
+	require.EqualValues(t, 1e6, result.Int32())
+	require.EqualValues(t, 3, calls)
+}
+
+func TestNumericStats(t *testing.T) {
+	runtime := NewRuntime()
+	defer runtime.Free()
+
+	context := runtime.NewContext()
+	defer context.Free()
+
+	for _, code := range []string{`[1, 2, 3, 4]`, `new Int16Array([4, 2, 1, 3])`, `new Float64Array([1, 4, 2, 3])`} {
+		val, err := context.Eval(code)
+		require.NoError(t, err)
+
+		min, max, sum, count, err := val.NumericStats()
+		require.NoError(t, err, code)
+		require.EqualValues(t, 1, min, code)
+		require.EqualValues(t, 4, max, code)
+		require.EqualValues(t, 10, sum, code)
+		require.EqualValues(t, 4, count, code)
+
+		val.Free()
+	}
+
+	for _, code := range []string{`[1, "2"]`, `new BigInt64Array(2)`, `({})`} {
+		val, err := context.Eval(code)
+		require.NoError(t, err)
+
+		_, _, _, _, err = val.NumericStats()
+		require.Error(t, err, code)
+
+		val.Free()
+	}
+}
+
+func TestEvalContext(t *testing.T) {
+	runtime := NewRuntime()
+	defer runtime.Free()
+
+	context := runtime.NewContext()
+	defer context.Free()
+
+	goctx, cancel := stdcontext.WithTimeout(stdcontext.Background(), 20*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+
+	result, err := context.EvalContext(goctx, `while (true) {}`)
+	defer result.Free()
+
+	require.True(t, errors.Is(err, stdcontext.DeadlineExceeded))
+	require.True(t, time.Since(start) < time.Second)
+
+	goctx, cancel = stdcontext.WithCancel(stdcontext.Background())
+	time.AfterFunc(20*time.Millisecond, cancel)
+
+	result, err = context.EvalContext(goctx, `while (true) {}`)
+	defer result.Free()
+
+	var interrupted *InterruptedError
+	require.True(t, errors.As(err, &interrupted))
+	require.True(t, errors.Is(err, stdcontext.Canceled))
+
+	result, err = context.EvalContext(goctx, `1 + 1`)
+	defer result.Free()
+
+	require.True(t, errors.Is(err, stdcontext.Canceled))
+
+	result, err = context.EvalContext(stdcontext.Background(), `1 + 1`)
+	require.NoError(t, err)
+	defer result.Free()
+
+	require.EqualValues(t, 2, result.Int32())
+}
+
+func TestErrorFormat(t *testing.T) {
+	runtime := NewRuntime()
+	defer runtime.Free()
+
+	context := runtime.NewContext()
+	defer context.Free()
+
+	result, err := context.EvalFile(`function fail() { throw new Error("boom"); }
+fail();`, "fail.js")
+	defer result.Free()
+
+	var jsErr *Error
+	require.True(t, errors.As(err, &jsErr))
+	require.EqualValues(t, "Error: boom", jsErr.Error())
+	require.EqualValues(t, "Error: boom", jsErr.Format(false))
+	require.EqualValues(t, "Error: boom\n    at fail (fail.js:1)\n    at <eval> (fail.js:2)", jsErr.Format(true))
+
+	runtime.SetErrorFormatter(func(err Error) string { return err.Format(true) })
+
+	result, err = context.EvalFile(`fail();`, "again.js")
+	defer result.Free()
+
+	require.EqualValues(t, "Error: boom\n    at fail (fail.js:1)\n    at <eval> (again.js:1)", err.Error())
+}
+
+func TestMemoryUsage(t *testing.T) {
+	runtime := NewRuntime()
+	defer runtime.Free()
+
+	context := runtime.NewContext()
+	defer context.Free()
+
+	before := runtime.MemoryUsage()
+	require.EqualValues(t, -1, before.MallocLimit)
+	require.True(t, before.MemoryUsedSize > 0)
+	require.True(t, before.AtomCount > 0)
+
+	result, err := context.Eval(`objects = Array.from({ length: 1000 }, (_, i) => ({ i }))`)
+	require.NoError(t, err)
+	defer result.Free()
+
+	after := runtime.MemoryUsage()
+	require.True(t, after.ObjCount >= before.ObjCount+1000)
+	require.True(t, after.MemoryUsedSize > before.MemoryUsedSize)
+
+	runtime.SetMemoryLimit(64 * 1024 * 1024)
+	require.EqualValues(t, 64*1024*1024, runtime.MemoryUsage().MallocLimit)
+}
+
+type closingBuffer struct {
+	bytes.Buffer
+	closed bool
+}
+
+func (b *closingBuffer) Close() error {
+	b.closed = true
+	return nil
+}
+
+func TestWritableStream(t *testing.T) {
+	runtime := NewRuntime()
+	defer runtime.Free()
+
+	context := runtime.NewContext()
+	defer context.Free()
+
+	var buf closingBuffer
+
+	context.Globals().Set("stream", context.WritableStream(&buf))
+
+	result, err := context.Eval(`
+		stream.write("hello, ");
+		stream.write(new Uint8Array([119, 111, 114, 108, 100]));
+		stream.close();
+	`)
+	require.NoError(t, err)
+	defer result.Free()
+
+	require.EqualValues(t, "hello, world", buf.String())
+	require.True(t, buf.closed)
+
+	result, err = context.Eval(`stream.write("more")`)
+	defer result.Free()
+
+	require.EqualError(t, err, "TypeError: cannot write to a closed stream")
+}
+
+func TestEvalModule(t *testing.T) {
+	runtime := NewRuntime()
+	defer runtime.Free()
+
+	runtime.SetModuleLoader(nil, func(moduleName string) ([]byte, error) {
+		return []byte(`export const base = 40;`), nil
+	})
+
+	context := runtime.NewContext()
+	defer context.Free()
+
+	ns, err := context.EvalModule(`
+		import { base } from "base";
+		export const answer = base + 2;
+		export let resolved = false;
+		Promise.resolve().then(() => { resolved = true; });
+	`, "main.mjs")
+	require.NoError(t, err)
+	defer ns.Free()
+
+	answer := ns.Get("answer")
+	defer answer.Free()
+
+	resolved := ns.Get("resolved")
+	defer resolved.Free()
+
+	require.EqualValues(t, 42, answer.Int32())
+	require.True(t, resolved.Bool())
+
+	result, err := context.EvalModule(`throw new Error("module failed");`, "failing.mjs")
+	defer result.Free()
+
+	require.EqualError(t, err, "Error: module failed")
+}
+
+func TestCallConsuming(t *testing.T) {
+	runtime := NewRuntime()
+	defer runtime.Free()
+
+	context := runtime.NewContext()
+	defer context.Free()
+
+	fn, err := context.Eval(`(obj, str) => obj.n + str.length`)
+	require.NoError(t, err)
+	defer fn.Free()
+
+	call := func(i int) {
+		obj := context.Object()
+		obj.Set("n", context.Int64(int64(i)))
+
+		result, err := fn.CallConsuming(context.Undefined(), obj, context.String(strings.Repeat("x", 1024)))
+		require.NoError(t, err)
+		require.EqualValues(t, i+1024, result.Int64())
+		result.Free()
+	}
+
+	call(0)
+	runtime.RunFullGC()
+	before := runtime.MemoryUsage()
+
+	for i := 0; i < 1000; i++ {
+		call(i)
+	}
+
+	runtime.RunFullGC()
+	after := runtime.MemoryUsage()
+
+	require.LessOrEqual(t, after.ObjCount, before.ObjCount)
+	require.LessOrEqual(t, after.StrCount, before.StrCount)
+}
+
+func TestModuleLoaderResolve(t *testing.T) {
+	runtime := NewRuntime()
+	defer runtime.Free()
+
+	files := map[string]string{
+		"/app/main.js":        `import { greet } from "./lib/utils.js"; export const message = greet("world");`,
+		"/app/lib/utils.js":   `import { prefix } from "../config.js"; export const greet = (name) => prefix + name;`,
+		"/app/config.js":      `export const prefix = "hello, ";`,
+		"/app/lib/broken.js":  `export const x = ;`,
+		"/app/lib/panicky.js": ``,
+	}
+
+	runtime.SetModuleLoader(func(moduleName, baseName string) string {
+		if moduleName == "panic" {
+			panic("resolver exploded")
+		}
+		return path.Join(path.Dir(baseName), moduleName)
+	}, func(moduleName string) ([]byte, error) {
+		if moduleName == "/app/lib/panicky.js" {
+			panic("loader exploded")
+		}
+		code, ok := files[moduleName]
+		if !ok {
+			return nil, fmt.Errorf("no such file")
+		}
+		return []byte(code), nil
+	})
+
+	context := runtime.NewContext()
+	defer context.Free()
+
+	ns, err := context.EvalModule(files["/app/main.js"], "/app/main.js")
+	require.NoError(t, err)
+	defer ns.Free()
+
+	message := ns.Get("message")
+	defer message.Free()
+
+	require.EqualValues(t, "hello, world", message.String())
+
+	tests := map[string]string{
+		`import "./missing.js";`:     "ReferenceError: could not load module '/app/missing.js': no such file",
+		`import "./lib/broken.js";`:  "SyntaxError: unexpected token in expression: ';'",
+		`import "./lib/panicky.js";`: "ReferenceError: could not load module '/app/lib/panicky.js': panic: loader exploded",
+		`import "panic";`:            "ReferenceError: could not resolve module 'panic': panic: resolver exploded",
+	}
+	for code, expected := range tests {
+		result, err := context.EvalModule(code, "/app/entry.js")
+		require.EqualError(t, err, expected)
+		result.Free()
+	}
+}
+
+func TestIsNativeFunction(t *testing.T) {
+	runtime := NewRuntime()
+	defer runtime.Free()
+
+	context := runtime.NewContext()
+	defer context.Free()
+
+	arrow, err := context.Eval(`() => 1`)
+	require.NoError(t, err)
+	defer arrow.Free()
+
+	require.False(t, arrow.IsNativeFunction())
+
+	native := context.Function(func(ctx *Context, this Value, args []Value) Value { return ctx.Undefined() })
+	defer native.Free()
+
+	require.True(t, native.IsNativeFunction())
+	require.False(t, arrow.IsNativeFunction())
+
+	obj := context.Object()
+	defer obj.Free()
+
+	require.False(t, obj.IsNativeFunction())
+}
+
+func TestExecuteAllPendingJobs(t *testing.T) {
+	runtime := NewRuntime()
+	defer runtime.Free()
+
+	context := runtime.NewContext()
+	defer context.Free()
+
+	result, err := context.Eval(`
+		settled = [];
+		Promise.resolve(1).then(x => settled.push(x)).then(() => settled.push(2));
+	`)
+	require.NoError(t, err)
+	defer result.Free()
+
+	require.NoError(t, runtime.ExecuteAllPendingJobs())
+
+	result, err = context.Eval(`settled.join(",")`)
+	require.NoError(t, err)
+	defer result.Free()
+
+	require.EqualValues(t, "1,2", result.String())
+
+	result, err = context.EvalWithOptions(`auto = false; Promise.resolve().then(() => { auto = true; }); 1`, EvalOptions{ExecutePendingJobs: true})
+	require.NoError(t, err)
+	defer result.Free()
+
+	auto := context.Globals().Get("auto")
+	defer auto.Free()
+
+	require.True(t, auto.Bool())
+}
+
+func TestGlobalThis(t *testing.T) {
+	runtime := NewRuntime()
+	defer runtime.Free()
+
+	context := runtime.NewContext()
+	defer context.Free()
+
+	for i := 0; i < 100; i++ {
+		global := context.GlobalThis()
+		global.Set("counter", context.Int32(int32(i)))
+		global.Free()
+	}
+
+	counter := context.Globals().Get("counter")
+	defer counter.Free()
+
+	require.EqualValues(t, 99, counter.Int32())
+
+	result, err := context.Eval(`typeof Object === "function" && globalThis.counter === 99`)
+	require.NoError(t, err)
+	defer result.Free()
+
+	require.True(t, result.Bool())
+}
+
+func TestAwait(t *testing.T) {
+	runtime := NewRuntime()
+	defer runtime.Free()
+
+	context := runtime.NewContext()
+	defer context.Free()
+
+	fn, err := context.Eval(`async (x) => {
+		for (let i = 0; i < 5; i++) await null;
+		if (x < 0) throw new RangeError("negative");
+		return x * 2;
+	}`)
+	require.NoError(t, err)
+	defer fn.Free()
+
+	promise, err := fn.Call(context.Undefined(), context.Int32(21))
+	require.NoError(t, err)
+	defer promise.Free()
+
+	result, err := promise.Await()
+	require.NoError(t, err)
+	require.EqualValues(t, 42, result.Int32())
+
+	rejected, err := fn.Call(context.Undefined(), context.Int32(-1))
+	require.NoError(t, err)
+	defer rejected.Free()
+
+	_, err = rejected.Await()
+	require.EqualError(t, err, "RangeError: negative")
+
+	thenable, err := context.Eval(`({ then(resolve) { resolve("thenable"); } })`)
+	require.NoError(t, err)
+	defer thenable.Free()
+
+	result, err = thenable.Await()
+	require.NoError(t, err)
+	defer result.Free()
+
+	require.EqualValues(t, "thenable", result.String())
+
+	pending, err := context.Eval(`new Promise(() => {})`)
+	require.NoError(t, err)
+	defer pending.Free()
+
+	_, err = pending.Await()
+	require.EqualError(t, err, "promise did not settle")
+
+	_, err = context.Int32(1).Await()
+	require.EqualError(t, err, "value is not a thenable")
+
+	counted, err := context.Eval(`
+		var reads = 0;
+		({ get then() { reads++; return (resolve) => resolve(reads); } })
+	`)
+	require.NoError(t, err)
+	defer counted.Free()
+
+	result, err = counted.Await()
+	require.NoError(t, err)
+	defer result.Free()
+	require.EqualValues(t, 1, result.Int32())
+
+	throwing, err := context.Eval(`({ get then() { throw new TypeError("no then"); } })`)
+	require.NoError(t, err)
+	defer throwing.Free()
+
+	_, err = throwing.Await()
+	require.EqualError(t, err, "TypeError: no then")
+}
+
+func TestEvalBool(t *testing.T) {
+	runtime := NewRuntime()
+	defer runtime.Free()
+
+	context := runtime.NewContext()
+	defer context.Free()
+
+	ok, err := context.EvalBool(`1 < 2`)
+	require.NoError(t, err)
+	require.True(t, ok)
+
+	ok, err = context.EvalBool(`""`)
+	require.NoError(t, err)
+	require.False(t, ok)
+
+	ok, err = context.EvalBool(`({})`)
+	require.NoError(t, err)
+	require.True(t, ok)
+
+	_, err = context.EvalBool(`missing.property`)
+	require.EqualError(t, err, "ReferenceError: 'missing' is not defined")
+}
+
+func TestNewPromise(t *testing.T) {
+	runtime := NewRuntime()
+	defer runtime.Free()
+
+	context := runtime.NewContext()
+	defer context.Free()
+
+	results := make(chan int64)
+	var resolvers []func(Value)
+
+	context.Globals().SetFunction("compute", func(ctx *Context, this Value, args []Value) Value {
+		promise, resolve, _ := ctx.NewPromise()
+		resolvers = append(resolvers, resolve)
+
+		n := args[0].Int64()
+		go func() { results <- n * n }()
+
+		return promise
+	})
+
+	promise, err := context.Eval(`compute(12).then((x) => x + 1)`)
+	require.NoError(t, err)
+	defer promise.Free()
+
+	resolvers[0](context.Int64(<-results))
+	resolvers[0](context.String("ignored"))
+
+	result, err := promise.Await()
+	require.NoError(t, err)
+	require.EqualValues(t, 145, result.Int64())
+
+	rejected, _, reject := context.NewPromise()
+	defer rejected.Free()
+
+	reject(context.Error(errors.New("failed")))
+
+	_, err = rejected.Await()
+	require.EqualError(t, err, "Error: failed")
+}
+
+func TestIndexOfAndIncludes(t *testing.T) {
+	runtime := NewRuntime()
+	defer runtime.Free()
+
+	context := runtime.NewContext()
+	defer context.Free()
+
+	arr, err := context.Eval(`[10, 20, 30, NaN]`)
+	require.NoError(t, err)
+	defer arr.Free()
+
+	idx, err := arr.IndexOf(context.Int32(20))
+	require.NoError(t, err)
+	require.EqualValues(t, 1, idx)
+
+	idx, err = arr.IndexOf(context.Int32(40))
+	require.NoError(t, err)
+	require.EqualValues(t, -1, idx)
+
+	found, err := arr.Includes(context.Float64(20))
+	require.NoError(t, err)
+	require.True(t, found)
+
+	found, err = arr.Includes(context.Int32(40))
+	require.NoError(t, err)
+	require.False(t, found)
+
+	found, err = arr.Includes(context.Float64(math.NaN()))
+	require.NoError(t, err)
+	require.True(t, found)
+
+	obj := context.Object()
+	defer obj.Free()
+
+	_, err = obj.IndexOf(context.Int32(1))
+	require.EqualError(t, err, "indexOf is not a function")
+}
+
+func TestPromiseState(t *testing.T) {
+	runtime := NewRuntime()
+	defer runtime.Free()
+
+	context := runtime.NewContext()
+	defer context.Free()
+
+	promises, err := context.Eval(`[new Promise(() => {}), Promise.resolve(42), Promise.reject(new Error("nope"))]`)
+	require.NoError(t, err)
+	defer promises.Free()
+
+	pending := promises.GetByUint32(0)
+	defer pending.Free()
+
+	fulfilled := promises.GetByUint32(1)
+	defer fulfilled.Free()
+
+	rejected := promises.GetByUint32(2)
+	defer rejected.Free()
+
+	ignore := context.Function(func(ctx *Context, this Value, args []Value) Value { return ctx.Undefined() })
+	defer ignore.Free()
+
+	result, err := rejected.CallMethod("catch", ignore)
+	require.NoError(t, err)
+	defer result.Free()
+
+	require.True(t, pending.IsPromise())
+	require.EqualValues(t, PromisePending, pending.PromiseState())
+	require.True(t, pending.PromiseResult().IsUndefined())
+
+	require.EqualValues(t, PromiseFulfilled, fulfilled.PromiseState())
+
+	value := fulfilled.PromiseResult()
+	require.EqualValues(t, 42, value.Int32())
+
+	require.EqualValues(t, PromiseRejected, rejected.PromiseState())
+	require.EqualValues(t, "rejected", rejected.PromiseState().String())
+
+	reason := rejected.PromiseResult()
+	defer reason.Free()
+
+	require.EqualValues(t, "Error: nope", reason.String())
+
+	require.False(t, promises.IsPromise())
+	require.EqualValues(t, "invalid", promises.PromiseState().String())
+}
+
+func TestAsyncGenerator(t *testing.T) {
+	runtime := NewRuntime()
+	defer runtime.Free()
+
+	context := runtime.NewContext()
+	defer context.Free()
+
+	context.Globals().Set("letters", context.AsyncGenerator(func(yield func(func(ctx *Context) Value) error) error {
+		for _, letter := range []string{"a", "b", "c"} {
+			letter := letter
+			if err := yield(func(ctx *Context) Value { return ctx.String(letter) }); err != nil {
+				return err
+			}
+		}
+		return nil
+	}))
+
+	var stopped error
+	context.Globals().Set("numbers", context.AsyncGenerator(func(yield func(func(ctx *Context) Value) error) error {
+		for i := 0; ; i++ {
+			i := i
+			if err := yield(func(ctx *Context) Value { return ctx.Int32(int32(i)) }); err != nil {
+				stopped = err
+				return nil
+			}
+		}
+	}))
+
+	context.Globals().Set("failing", context.AsyncGenerator(func(yield func(func(ctx *Context) Value) error) error {
+		return errors.New("generator failed")
+	}))
+
+	context.Globals().Set("panicking", context.AsyncGenerator(func(yield func(func(ctx *Context) Value) error) error {
+		panic("boom")
+	}))
+
+	result, err := context.EvalWithOptions(`
+		(async () => {
+			const out = [];
+			for await (const letter of letters) out.push(letter);
+			for await (const n of numbers) {
+				if (n === 2) break;
+				out.push(n);
+			}
+			try {
+				for await (const _ of failing);
+			} catch (err) {
+				out.push(err.message);
+			}
+			try {
+				for await (const _ of panicking);
+			} catch (err) {
+				out.push(err.message);
+			}
+			collected = out.join(",");
+		})()
+	`, EvalOptions{ExecutePendingJobs: true})
+	require.NoError(t, err)
+	defer result.Free()
+
+	collected := context.Globals().Get("collected")
+	defer collected.Free()
+
+	require.EqualValues(t, "a,b,c,0,1,generator failed,async generator panicked: boom", collected.String())
+	require.True(t, errors.Is(stopped, ErrGeneratorClosed))
+}
+
+func TestFunctionWithSource(t *testing.T) {
+	runtime := NewRuntime()
+	defer runtime.Free()
+
+	context := runtime.NewContext()
+	defer context.Free()
+
+	fn := context.FunctionWithSource("fetchUser", "users.go", 42, func(ctx *Context, this Value, args []Value) Value {
+		return ctx.ThrowError(errors.New("user not found"))
+	})
+	require.False(t, fn.IsException())
+	context.Globals().Set("fetchUser", fn)
+
+	name, err := context.Eval(`fetchUser.name`)
+	require.NoError(t, err)
+	defer name.Free()
+	require.EqualValues(t, "fetchUser", name.String())
+
+	_, err = context.Eval(`fetchUser()`)
+	require.Error(t, err)
+
+	var evalErr *Error
+	require.True(t, errors.As(err, &evalErr))
+	require.EqualValues(t, "Error: user not found", evalErr.Cause)
+	require.Contains(t, evalErr.Stack, "at fetchUser (users.go:42)")
+
+	fn = context.FunctionWithSource("far", "far.go", maxSourceLine+1, func(ctx *Context, this Value, args []Value) Value {
+		return ctx.Undefined()
+	})
+	require.True(t, fn.IsException())
+	require.EqualError(t, context.Exception(), "RangeError: line 65537 exceeds 65536")
+}
+
+func TestStringMethods(t *testing.T) {
+	runtime := NewRuntime()
+	defer runtime.Free()
+
+	context := runtime.NewContext()
+	defer context.Free()
+
+	line := context.String("  id,name,,email  ")
+	defer line.Free()
+
+	trimmed, err := line.Trim()
+	require.NoError(t, err)
+	defer trimmed.Free()
+	require.EqualValues(t, "id,name,,email", trimmed.String())
+
+	fields, err := trimmed.Split(",")
+	require.NoError(t, err)
+	require.EqualValues(t, []string{"id", "name", "", "email"}, fields)
+
+	replaced, err := trimmed.Replace(",", ";")
+	require.NoError(t, err)
+	defer replaced.Free()
+	require.EqualValues(t, "id;name,,email", replaced.String())
+
+	quoted, err := trimmed.Replace("name", "'$&'")
+	require.NoError(t, err)
+	defer quoted.Free()
+	require.EqualValues(t, "id,'name',,email", quoted.String())
+
+	num := context.Int32(1)
+	defer num.Free()
+
+	_, err = num.Split(",")
+	require.EqualError(t, err, "value is not a string")
+}
+
+func TestJSON(t *testing.T) {
+	runtime := NewRuntime()
+	defer runtime.Free()
+
+	context := runtime.NewContext()
+	defer context.Free()
+
+	val, err := context.ParseJSON(`{"name":"quickjs","tags":["js","go"],"stars":1}`)
+	require.NoError(t, err)
+	defer val.Free()
+
+	json, err := val.JSON()
+	require.NoError(t, err)
+	require.EqualValues(t, `{"name":"quickjs","tags":["js","go"],"stars":1}`, json)
+
+	fromBytes, err := context.ParseJSONBytes([]byte(`[1, 2, 3]`))
+	require.NoError(t, err)
+	defer fromBytes.Free()
+	require.EqualValues(t, 3, fromBytes.Len())
+
+	_, err = context.ParseJSON(`{"name":`)
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "SyntaxError")
+
+	_, err = context.ParseJSONBytes([]byte(`{"a":1}garbage`))
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "SyntaxError")
+
+	prefix, err := context.ParseJSONBytes([]byte(`[1]garbage`)[:3])
+	require.NoError(t, err)
+	defer prefix.Free()
+	require.EqualValues(t, 1, prefix.Len())
+
+	_, err = context.ParseJSONBytes(nil)
+	require.Error(t, err)
+
+	cyclic, err := context.Eval(`const cyclic = {}; cyclic.self = cyclic; cyclic`)
+	require.NoError(t, err)
+	defer cyclic.Free()
+
+	_, err = cyclic.JSON()
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "TypeError")
+
+	undef := context.Undefined()
+	json, err = undef.JSON()
+	require.NoError(t, err)
+	require.EqualValues(t, "", json)
+}
+
+func TestSetMaxFunctions(t *testing.T) {
+	runtime := NewRuntime()
+	defer runtime.Free()
+
+	runtime.SetMaxFunctions(2)
+
+	context := runtime.NewContext()
+	defer context.Free()
+
+	noop := func(ctx *Context, this Value, args []Value) Value { return ctx.Undefined() }
+
+	var fns []Value
+	for i := 0; i < 2; i++ {
+		fn := context.Function(noop)
+		require.False(t, fn.IsException())
+		fns = append(fns, fn)
+	}
+
+	fn := context.Function(noop)
+	require.True(t, fn.IsException())
+
+	err := context.Exception()
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "too many functions registered (max 2)")
+
+	fns[0].Free()
+	runtime.RunGC()
+
+	fn = context.Function(noop)
+	require.False(t, fn.IsException())
+	fns[0] = fn
+
+	fn = context.Function(noop)
+	require.True(t, fn.IsException())
+	require.Error(t, context.Exception())
+
+	runtime.SetMaxFunctions(0)
+
+	fn = context.Function(noop)
+	require.False(t, fn.IsException())
+	fn.Free()
+
+	for _, fn := range fns {
+		fn.Free()
+	}
+}
+
+func TestCall(t *testing.T) {
+	runtime := NewRuntime()
+	defer runtime.Free()
+
+	context := runtime.NewContext()
+	defer context.Free()
+
+	ns, err := context.EvalModule(`
+		export function add(a, b) { return a + b; }
+		export function self() { return this === undefined; }
+		export function fail() { throw new TypeError("bad input"); }
+	`, "math.mjs")
+	require.NoError(t, err)
+	defer ns.Free()
+
+	add := ns.Get("add")
+	defer add.Free()
+
+	a, b := context.Int32(2), context.Int32(3)
+	sum, err := add.Call(context.Undefined(), a, b)
+	require.NoError(t, err)
+	defer sum.Free()
+	require.EqualValues(t, 5, sum.Int32())
+
+	self := ns.Get("self")
+	defer self.Free()
+
+	unbound, err := self.Call(context.Undefined())
+	require.NoError(t, err)
+	require.True(t, unbound.Bool())
+
+	fail := ns.Get("fail")
+	defer fail.Free()
+
+	_, err = fail.Call(context.Undefined())
+	require.EqualError(t, err, "TypeError: bad input")
+
+	_, err = a.Call(context.Undefined())
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "TypeError")
+}
+
+func TestToBigInt64Slice(t *testing.T) {
+	runtime := NewRuntime()
+	defer runtime.Free()
+
+	context := runtime.NewContext()
+	defer context.Free()
+
+	arr, err := context.Eval(`
+		const buf = new BigInt64Array([0n, -1n, 9007199254740993n, -9223372036854775808n, 9223372036854775807n, 5n]);
+		buf.subarray(1, 5)
+	`)
+	require.NoError(t, err)
+	defer arr.Free()
+
+	values, err := arr.ToBigInt64Slice()
+	require.NoError(t, err)
+	require.EqualValues(t, []int64{-1, 1<<53 + 1, math.MinInt64, math.MaxInt64}, values)
+
+	empty, err := context.Eval(`new BigInt64Array(0)`)
+	require.NoError(t, err)
+	defer empty.Free()
+
+	values, err = empty.ToBigInt64Slice()
+	require.NoError(t, err)
+	require.Empty(t, values)
+
+	floats, err := context.Eval(`new Float64Array([1])`)
+	require.NoError(t, err)
+	defer floats.Free()
+
+	_, err = floats.ToBigInt64Slice()
+	require.EqualError(t, err, "value is not a BigInt64Array")
+
+	spoofed, err := context.Eval(`Object.setPrototypeOf(new Float64Array([1]), BigInt64Array.prototype)`)
+	require.NoError(t, err)
+	defer spoofed.Free()
+
+	_, err = spoofed.ToBigInt64Slice()
+	require.EqualError(t, err, "value is not a BigInt64Array")
+}
+
+func TestNew(t *testing.T) {
+	runtime := NewRuntime()
+	defer runtime.Free()
+
+	context := runtime.NewContext()
+	defer context.Free()
+
+	class, err := context.Eval(`
+		(class Point {
+			constructor(x, y) {
+				if (typeof x !== "number") throw new TypeError("x must be a number");
+				this.x = x;
+				this.y = y ?? 0;
+			}
+		})
+	`)
+	require.NoError(t, err)
+	defer class.Free()
+	require.True(t, class.IsConstructor())
+
+	x, y := context.Int32(1), context.Int32(2)
+	point, err := class.New(x, y)
+	require.NoError(t, err)
+	defer point.Free()
+	require.EqualValues(t, "Point", point.ConstructorName())
+	require.EqualValues(t, 2, GetOr(point, "y", 0))
+
+	_, err = class.New()
+	require.EqualError(t, err, "TypeError: x must be a number")
+
+	arrow, err := context.Eval(`() => {}`)
+	require.NoError(t, err)
+	defer arrow.Free()
+	require.False(t, arrow.IsConstructor())
+
+	_, err = arrow.New()
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "TypeError")
+	require.Contains(t, err.Error(), "not a constructor")
+}
+
+func TestStreamJSON(t *testing.T) {
+	runtime := NewRuntime()
+	defer runtime.Free()
+
+	context := runtime.NewContext()
+	defer context.Free()
+
+	var doc strings.Builder
+	doc.WriteString("\n  [")
+	for i := 0; i < 10000; i++ {
+		if i > 0 {
+			doc.WriteString(",")
+		}
+		fmt.Fprintf(&doc, `{"id":%d,"name":"item %d","tags":["a","b"]}`, i, i)
+	}
+	doc.WriteString("]\n")
+
+	var (
+		count int
+		sum   int64
+		last  string
+	)
+	err := context.StreamJSON(strings.NewReader(doc.String()), func(path string, v Value) error {
+		count++
+		sum += int64(GetOr(v, "id", 0))
+		last = path
+		return nil
+	})
+	require.NoError(t, err)
+	require.EqualValues(t, 10000, count)
+	require.EqualValues(t, 9999*10000/2, sum)
+	require.EqualValues(t, "[9999]", last)
+
+	stop := errors.New("stop")
+	count = 0
+	err = context.StreamJSON(strings.NewReader(doc.String()), func(path string, v Value) error {
+		if count++; count == 3 {
+			return stop
+		}
+		return nil
+	})
+	require.Equal(t, stop, err)
+	require.EqualValues(t, 3, count)
+
+	err = context.StreamJSON(strings.NewReader(`{"single":true}`), func(path string, v Value) error {
+		require.EqualValues(t, "", path)
+		require.True(t, GetOr(v, "single", false))
+		return nil
+	})
+	require.NoError(t, err)
+
+	err = context.StreamJSON(strings.NewReader(`[1, 2,`), func(path string, v Value) error { return nil })
+	require.Error(t, err)
+}
+
+func TestCallMethod(t *testing.T) {
+	runtime := NewRuntime()
+	defer runtime.Free()
+
+	context := runtime.NewContext()
+	defer context.Free()
+
+	counter, err := context.Eval(`({
+		count: 0,
+		add(n) { this.count += n; return this.count; },
+		get broken() { throw new Error("broken getter"); },
+		label: "counter",
+	})`)
+	require.NoError(t, err)
+	defer counter.Free()
+
+	n := context.Int32(2)
+	for i := 1; i <= 3; i++ {
+		count, err := counter.CallMethod("add", n)
+		require.NoError(t, err)
+		require.EqualValues(t, 2*i, count.Int32())
+	}
+	require.EqualValues(t, 6, GetOr(counter, "count", 0))
+
+	_, err = counter.CallMethod("label")
+	require.EqualError(t, err, "label is not a function")
+
+	_, err = counter.CallMethod("missing")
+	require.EqualError(t, err, "missing is not a function")
+
+	_, err = counter.CallMethod("broken")
+	require.EqualError(t, err, "Error: broken getter")
+}
+
+func TestCallAfterThrow(t *testing.T) {
+	runtime := NewRuntime()
+	defer runtime.Free()
+
+	context := runtime.NewContext()
+	defer context.Free()
+
+	parse, err := context.Eval(`(input) => JSON.parse(input).value`)
+	require.NoError(t, err)
+	defer parse.Free()
+
+	inputs := []string{`{"value":1}`, `{bad`, `{"value":2}`, `]`, `{"value":3}`}
+	expected := []interface{}{1, "SyntaxError", 2, "SyntaxError", 3}
+
+	for i, input := range inputs {
+		arg := context.String(input)
+		result, err := parse.Call(context.Undefined(), arg)
+		arg.Free()
+
+		if cause, ok := expected[i].(string); ok {
+			require.Error(t, err)
+			require.Contains(t, err.Error(), cause)
+			continue
+		}
+		require.NoError(t, err, input)
+		require.EqualValues(t, expected[i], result.Int32())
+	}
+
+	interrupt := true
+	runtime.SetInterruptHandler(func() bool { return interrupt })
+
+	loop, err := context.Eval(`() => { for (let i = 0; i < 1e6; i++) {} return "done"; }`)
+	require.NoError(t, err)
+	defer loop.Free()
+
+	_, err = loop.Call(context.Undefined())
+	var interrupted *InterruptedError
+	require.True(t, errors.As(err, &interrupted))
+
+	interrupt = false
+
+	done, err := loop.Call(context.Undefined())
+	require.NoError(t, err)
+	defer done.Free()
+	require.EqualValues(t, "done", done.String())
+
+	arg := context.String(`{"value":4}`)
+	defer arg.Free()
+
+	result, err := parse.Call(context.Undefined(), arg)
+	require.NoError(t, err)
+	require.EqualValues(t, 4, result.Int32())
+}
+
+func TestIsInstanceOf(t *testing.T) {
+	runtime := NewRuntime()
+	defer runtime.Free()
+
+	context := runtime.NewContext()
+	defer context.Free()
+
+	classes, err := context.Eval(`
+		class ValidationError extends Error {}
+		({ ValidationError, err: new ValidationError("invalid"), plain: new Error("plain") })
+	`)
+	require.NoError(t, err)
+	defer classes.Free()
+
+	validationError := classes.Get("ValidationError")
+	defer validationError.Free()
+
+	errorCtor := context.Globals().Get("Error")
+	defer errorCtor.Free()
+
+	custom := classes.Get("err")
+	defer custom.Free()
+
+	plain := classes.Get("plain")
+	defer plain.Free()
+
+	require.True(t, custom.IsInstanceOf(validationError))
+	require.True(t, custom.IsInstanceOf(errorCtor))
+	require.True(t, plain.IsInstanceOf(errorCtor))
+	require.False(t, plain.IsInstanceOf(validationError))
+
+	num := context.Int32(1)
+	require.False(t, num.IsInstanceOf(errorCtor))
+
+	require.False(t, custom.IsInstanceOf(num))
+	require.False(t, custom.IsInstanceOf(context.Undefined()))
+
+	result, err := context.Eval(`1 + 1`)
+	require.NoError(t, err)
+	require.EqualValues(t, 2, result.Int32())
+}
+
+func TestEvalModuleWithImports(t *testing.T) {
+	runtime := NewRuntime()
+	defer runtime.Free()
+
+	context := runtime.NewContext()
+	defer context.Free()
+
+	dep := context.Object()
+	defer dep.Free()
+
+	dep.Set("prefix", context.String("Hello"))
+	dep.Set("greet", context.Function(func(ctx *Context, this Value, args []Value) Value {
+		return ctx.String("Hello, " + args[0].String() + "!")
+	}))
+
+	ns, err := context.EvalModuleWithImports(`
+		import { greet, prefix } from "dep";
+		import dep from "dep";
+		export const greeting = greet("quickjs");
+		export const same = dep.prefix === prefix;
+	`, "main.mjs", map[string]Value{"dep": dep})
+	require.NoError(t, err)
+	defer ns.Free()
+
+	require.EqualValues(t, "Hello, quickjs!", GetOr(ns, "greeting", ""))
+	require.True(t, GetOr(ns, "same", false))
+
+	_, err = context.EvalModuleWithImports(`import { missing } from "dep";`, "missing.mjs", map[string]Value{"dep": dep})
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "missing")
+
+	_, err = context.EvalModule(`import { other } from "other";`, "other.mjs")
+	require.Error(t, err)
+
+	ns, err = context.EvalModuleWithImports(`import { prefix } from "dep"; export { prefix };`, "again.mjs", map[string]Value{"dep": dep})
+	require.NoError(t, err)
+	defer ns.Free()
+	require.EqualValues(t, "Hello", GetOr(ns, "prefix", ""))
+
+	other := context.Object()
+	defer other.Free()
+
+	_, err = context.EvalModuleWithImports(`import { prefix } from "dep";`, "other-dep.mjs", map[string]Value{"dep": other})
+	require.EqualError(t, err, "module 'dep' is already loaded from a different value")
+}
+
+func TestDup(t *testing.T) {
+	runtime := NewRuntime()
+	defer runtime.Free()
+
+	context := runtime.NewContext()
+	defer context.Free()
+
+	handlers := make(map[string]Value)
+	defer func() {
+		for _, handler := range handlers {
+			handler.Free()
+		}
+	}()
+
+	context.Globals().Set("register", context.Function(func(ctx *Context, this Value, args []Value) Value {
+		handlers[args[0].String()] = args[1].Dup()
+		return ctx.Undefined()
+	}))
+
+	result, err := context.Eval(`
+		register("double", (n) => n * 2);
+		register("square", (n) => n * n);
+	`)
+	require.NoError(t, err)
+	result.Free()
+
+	runtime.RunGC()
+
+	n := context.Int32(4)
+
+	doubled, err := handlers["double"].Call(context.Undefined(), n)
+	require.NoError(t, err)
+	require.EqualValues(t, 8, doubled.Int32())
+
+	squared, err := handlers["square"].Call(context.Undefined(), n)
+	require.NoError(t, err)
+	require.EqualValues(t, 16, squared.Int32())
+
+	str := context.String("retained")
+	dup := str.Dup()
+	str.Free()
+	defer dup.Free()
+	require.EqualValues(t, "retained", dup.String())
+}
+
+func TestTag(t *testing.T) {
+	runtime := NewRuntime()
+	defer runtime.Free()
+
+	context := runtime.NewContext()
+	defer context.Free()
+
+	tests := []struct {
+		code string
+		tag  int
+	}{
+		{`42`, TagInt},
+		{`4.2`, TagFloat64},
+		{`"str"`, TagString},
+		{`true`, TagBool},
+		{`null`, TagNull},
+		{`undefined`, TagUndefined},
+		{`({})`, TagObject},
+		{`Symbol("s")`, TagSymbol},
+		{`10n`, TagBigInt},
+	}
+
+	for _, test := range tests {
+		val, err := context.Eval(test.code)
+		require.NoError(t, err)
+		require.EqualValues(t, test.tag, val.Tag(), test.code)
+		val.Free()
+	}
+}
+
+func TestFunctionFinalizer(t *testing.T) {
+	runtime := NewRuntime()
+	defer runtime.Free()
+
+	runtime.SetMaxFunctions(100)
+
+	context := runtime.NewContext()
+	defer context.Free()
+
+	stored := func() int {
+		funcPtrLock.Lock()
+		defer funcPtrLock.Unlock()
+
+		count := 0
+		for _, entry := range funcPtrStore {
+			if entry.ctx == context {
+				count++
+			}
+		}
+		return count
+	}
+
+	kept := context.Function(func(ctx *Context, this Value, args []Value) Value { return ctx.Int32(1) })
+	defer kept.Free()
+
+	for i := 0; i < 5000; i++ {
+		fn := context.Function(func(ctx *Context, this Value, args []Value) Value { return ctx.Undefined() })
+		require.False(t, fn.IsException())
+		fn.Free()
+
+		if i%50 == 0 {
+			runtime.RunGC()
+		}
+	}
+	runtime.RunGC()
+
+	require.EqualValues(t, 1, stored())
+
+	result, err := kept.Call(context.Undefined())
+	require.NoError(t, err)
+	require.EqualValues(t, 1, result.Int32())
+}
+
+func TestHardenPrototypes(t *testing.T) {
+	runtime := NewRuntime()
+	defer runtime.Free()
+
+	context := runtime.NewContext()
+	defer context.Free()
+
+	require.NoError(t, context.HardenPrototypes())
+
+	_, err := context.Eval(`"use strict"; Object.prototype.polluted = 1;`)
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "TypeError")
+
+	result, err := context.Eval(`
+		Object.prototype.polluted = 1;
+		Array.prototype.map = () => "hijacked";
+		JSON.parse = () => "hijacked";
+		[({}).polluted, [1, 2].map((n) => n * 2).join(","), JSON.parse("1")]
+	`)
+	require.NoError(t, err)
+	defer result.Free()
+
+	json, err := result.JSON()
+	require.NoError(t, err)
+	require.EqualValues(t, `[null,"2,4",1]`, json)
+
+	_, err = context.Eval(`"use strict"; Object.getPrototypeOf(Uint8Array.prototype).fill = null;`)
+	require.Error(t, err)
+
+	_, err = context.Eval(`"use strict"; Object.getPrototypeOf([][Symbol.iterator]()).next = null;`)
+	require.Error(t, err)
+
+	own, err := context.Eval(`const obj = {}; Object.defineProperty(obj, "toString", { value: () => "own" }); String(obj)`)
+	require.NoError(t, err)
+	defer own.Free()
+	require.EqualValues(t, "own", own.String())
+
+	unfrozen, err := context.Eval(`[
+		"Object", "Function", "Array", "String", "Number", "Boolean", "Symbol", "BigInt", "Date", "RegExp", "Promise",
+		"Proxy", "Map", "Set", "WeakMap", "WeakSet", "ArrayBuffer", "SharedArrayBuffer", "DataView",
+		"Error", "EvalError", "RangeError", "ReferenceError", "SyntaxError", "TypeError", "URIError", "InternalError",
+		"Int8Array", "Uint8Array", "Uint8ClampedArray", "Int16Array", "Uint16Array", "Int32Array", "Uint32Array",
+		"Float32Array", "Float64Array", "BigInt64Array", "BigUint64Array",
+		"BigFloat", "BigDecimal", "BigFloatEnv", "Operators",
+	].filter((name) => {
+		const constructor = globalThis[name];
+		return !Object.isFrozen(constructor) || (constructor.prototype && !Object.isFrozen(constructor.prototype));
+	}).join(",")`)
+	require.NoError(t, err)
+	defer unfrozen.Free()
+	require.EqualValues(t, "", unfrozen.String())
+}
+
+func TestFunctionWithError(t *testing.T) {
+	runtime := NewRuntime()
+	defer runtime.Free()
+
+	context := runtime.NewContext()
+	defer context.Free()
+
+	context.Globals().Set("lookup", context.FunctionWithError(func(ctx *Context, this Value, args []Value) (Value, error) {
+		if len(args) == 0 || !args[0].IsString() {
+			return Value{}, errors.New("lookup expects a key")
+		}
+		if args[0].String() == "partial" {
+			return ctx.String("discarded"), fmt.Errorf("key %q not found", args[0].String())
+		}
+		return ctx.String("value of " + args[0].String()), nil
+	}))
+
+	result, err := context.Eval(`lookup("a")`)
+	require.NoError(t, err)
+	defer result.Free()
+	require.EqualValues(t, "value of a", result.String())
+
+	_, err = context.Eval(`lookup()`)
+	require.EqualError(t, err, "Error: lookup expects a key")
+
+	_, err = context.Eval(`lookup("partial")`)
+	require.EqualError(t, err, `Error: key "partial" not found`)
+
+	caught, err := context.Eval(`try { lookup(1) } catch (err) { err instanceof Error && err.message }`)
+	require.NoError(t, err)
+	defer caught.Free()
+	require.EqualValues(t, "lookup expects a key", caught.String())
+}
+
+func TestIsCallable(t *testing.T) {
+	runtime := NewRuntime()
+	defer runtime.Free()
+
+	context := runtime.NewContext()
+	defer context.Free()
+
+	native := context.Function(func(ctx *Context, this Value, args []Value) Value { return ctx.Undefined() })
+	defer native.Free()
+	require.True(t, native.IsCallable())
+
+	tests := []struct {
+		code     string
+		callable bool
+	}{
+		{`new Proxy(function() {}, { apply: () => 42 })`, true},
+		{`new Proxy(() => {}, {})`, true},
+		{`(function() { return this; }).bind(null)`, true},
+		{`(class {})`, true},
+		{`async () => {}`, true},
+		{`new Proxy({}, { apply: () => 42 })`, false},
+		{`({ call() {} })`, false},
+		{`"function"`, false},
+		{`undefined`, false},
+	}
+
+	for _, test := range tests {
+		val, err := context.Eval(test.code)
+		require.NoError(t, err)
+		require.EqualValues(t, test.callable, val.IsCallable(), test.code)
+		require.EqualValues(t, test.callable, val.IsFunction(), test.code)
+		val.Free()
+	}
+
+	trapped, err := context.Eval(`new Proxy(function() {}, { apply: () => 42 })`)
+	require.NoError(t, err)
+	defer trapped.Free()
+
+	result, err := trapped.Call(context.Undefined())
+	require.NoError(t, err)
+	require.EqualValues(t, 42, result.Int32())
+}
+
+func TestFunctionPanic(t *testing.T) {
+	runtime := NewRuntime()
+	defer runtime.Free()
+
+	context := runtime.NewContext()
+	defer context.Free()
+
+	context.Globals().Set("explode", context.Function(func(ctx *Context, this Value, args []Value) Value {
+		var m map[string]int
+		m["key"] = 1
+		return ctx.Undefined()
+	}))
+	context.Globals().Set("fail", context.Function(func(ctx *Context, this Value, args []Value) Value {
+		panic(errors.New("database unavailable"))
+	}))
+
+	_, err := context.Eval(`explode()`)
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "Error: panic: assignment to entry in nil map")
+
+	caught, err := context.Eval(`try { fail(); } catch (err) { err.message }`)
+	require.NoError(t, err)
+	defer caught.Free()
+	require.EqualValues(t, "panic: database unavailable", caught.String())
+
+	result, err := context.Eval(`1 + 1`)
+	require.NoError(t, err)
+	require.EqualValues(t, 2, result.Int32())
+}
+
+func TestCheckedConversions(t *testing.T) {
+	runtime := NewRuntime()
+	defer runtime.Free()
+
+	context := runtime.NewContext()
+	defer context.Free()
+
+	num, err := context.Eval(`"42"`)
+	require.NoError(t, err)
+	defer num.Free()
+
+	i64, err := num.ToInt64()
+	require.NoError(t, err)
+	require.EqualValues(t, 42, i64)
+
+	f64, err := num.ToFloat64()
+	require.NoError(t, err)
+	require.EqualValues(t, 42, f64)
+
+	tests := []struct {
+		code string
+		err  string
+	}{
+		{`12345678901234567890n`, "TypeError"},
+		{`Symbol("s")`, "TypeError"},
+		{`({ valueOf() { throw new RangeError("no number"); } })`, "RangeError: no number"},
+	}
+
+	for _, test := range tests {
+		val, err := context.Eval(test.code)
+		require.NoError(t, err)
+
+		_, err = val.ToInt64()
+		require.Error(t, err, test.code)
+		require.Contains(t, err.Error(), test.err)
+
+		_, err = val.ToInt32()
+		require.Error(t, err, test.code)
+
+		_, err = val.ToUint32()
+		require.Error(t, err, test.code)
+
+		_, err = val.ToFloat64()
+		require.Error(t, err, test.code)
+
+		require.EqualValues(t, 0, val.Int64())
+
+		val.Free()
+	}
+
+	result, err := context.Eval(`1 + 1`)
+	require.NoError(t, err)
+	require.EqualValues(t, 2, result.Int32())
+}
+
+func TestSetLength(t *testing.T) {
+	runtime := NewRuntime()
+	defer runtime.Free()
+
+	context := runtime.NewContext()
+	defer context.Free()
+
+	arr, err := context.Eval(`[1, 2, 3, 4, 5]`)
+	require.NoError(t, err)
+	defer arr.Free()
+
+	require.NoError(t, arr.SetLength(2))
+	require.EqualValues(t, 2, arr.Len())
+
+	json, err := arr.JSON()
+	require.NoError(t, err)
+	require.EqualValues(t, `[1,2]`, json)
+
+	require.NoError(t, arr.SetLength(4))
+	require.EqualValues(t, 4, arr.Len())
+
+	hole := arr.GetByUint32(3)
+	require.True(t, hole.IsUndefined())
+
+	err = arr.SetLength(-1)
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "RangeError")
+
+	frozen, err := context.Eval(`Object.freeze([1, 2, 3])`)
+	require.NoError(t, err)
+	defer frozen.Free()
+
+	err = frozen.SetLength(1)
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "TypeError")
+	require.EqualValues(t, 3, frozen.Len())
+
+	obj := context.Object()
+	defer obj.Free()
+	require.EqualError(t, obj.SetLength(1), "value is not an array")
+}
+
+func TestContextBigInt(t *testing.T) {
+	runtime := NewRuntime()
+	defer runtime.Free()
+
+	context := runtime.NewContext()
+	defer context.Free()
+
+	p256, ok := new(big.Int).SetString("115792089210356248762697446949553987143251281087023327633396908097000034115041", 10)
+	require.True(t, ok)
+
+	tests := []*big.Int{
+		big.NewInt(0),
+		big.NewInt(-1),
+		big.NewInt(math.MaxInt64),
+		big.NewInt(math.MinInt64),
+		new(big.Int).Add(big.NewInt(math.MaxInt64), big.NewInt(1)),
+		p256,
+		new(big.Int).Neg(p256),
+	}
+
+	for _, test := range tests {
+		val := context.BigInt(test)
+		require.True(t, val.IsBigInt(), test.String())
+		require.EqualValues(t, 0, test.Cmp(val.BigInt()), test.String())
+		val.Free()
+	}
+
+	val := context.BigInt(p256)
+	defer val.Free()
+	context.Globals().Set("p", val.Dup())
+
+	result, err := context.Eval(`(p % 1000n).toString() + ":" + typeof p`)
+	require.NoError(t, err)
+	defer result.Free()
+	require.EqualValues(t, "41:bigint", result.String())
+
+	null := context.BigInt(nil)
+	require.True(t, null.IsNull())
+}
+
+func TestAggregateError(t *testing.T) {
+	runtime := NewRuntime()
+	defer runtime.Free()
+
+	context := runtime.NewContext()
+	defer context.Free()
+
+	first := context.Error(errors.New("first failed"))
+	defer first.Free()
+
+	second := context.Error(errors.New("second failed"))
+	defer second.Free()
+
+	aggregate := context.AggregateError([]Value{first, second}, "all requests failed")
+	require.False(t, aggregate.IsException())
+	require.True(t, aggregate.IsError())
+	context.Globals().Set("aggregate", aggregate)
+
+	result, err := context.Eval(`[
+		aggregate instanceof AggregateError,
+		aggregate.message,
+		aggregate.errors.length,
+		aggregate.errors.map((err) => err.message).join(","),
+	].join("|")`)
+	require.NoError(t, err)
+	defer result.Free()
+	require.EqualValues(t, "true|all requests failed|2|first failed,second failed", result.String())
+
+	_, err = context.Eval(`throw aggregate`)
+	require.EqualError(t, err, "AggregateError: all requests failed")
+
+	empty := context.AggregateError(nil, "none")
+	defer empty.Free()
+	errs := empty.Get("errors")
+	defer errs.Free()
+	require.True(t, errs.IsArray())
+	require.EqualValues(t, 0, errs.Len())
+
+	result, err = context.Eval(`globalThis.BuiltinAggregateError = AggregateError; AggregateError = 1`)
+	require.NoError(t, err)
+	result.Free()
+
+	spoofed := context.AggregateError([]Value{first}, "still built in")
+	require.False(t, spoofed.IsException())
+	context.Globals().Set("spoofed", spoofed)
+
+	result, err = context.Eval(`spoofed instanceof BuiltinAggregateError && spoofed.message === "still built in"`)
+	require.NoError(t, err)
+	defer result.Free()
+	require.True(t, result.Bool())
+}
+
+func TestUint8Array(t *testing.T) {
+	runtime := NewRuntime()
+	defer runtime.Free()
+
+	context := runtime.NewContext()
+	defer context.Free()
+
+	data := []byte{0x08, 0x96, 0x01, 0xff, 0x00}
+
+	arr := context.Uint8Array(data)
+	require.False(t, arr.IsException())
+	context.Globals().Set("payload", arr.Dup())
+	defer arr.Free()
+
+	data[0] = 0
+	require.EqualValues(t, 8, GetOr(arr, "0", 0))
+
+	sum, err := context.Eval(`payload.reduce((a, b) => a + b, 0) + ":" + (payload instanceof Uint8Array)`)
+	require.NoError(t, err)
+	defer sum.Free()
+	require.EqualValues(t, "414:true", sum.String())
+
+	tests := []struct {
+		code     string
+		expected []byte
+	}{
+		{`payload`, []byte{0x08, 0x96, 0x01, 0xff, 0x00}},
+		{`payload.subarray(1, 3)`, []byte{0x96, 0x01}},
+		{`payload.buffer`, []byte{0x08, 0x96, 0x01, 0xff, 0x00}},
+		{`new Uint16Array([1, 256])`, []byte{0x01, 0x00, 0x00, 0x01}},
+		{`new Uint8Array(0)`, []byte{}},
+	}
+
+	for _, test := range tests {
+		val, err := context.Eval(test.code)
+		require.NoError(t, err)
+
+		b, err := val.ToBytes()
+		require.NoError(t, err, test.code)
+		require.EqualValues(t, test.expected, b, test.code)
+		val.Free()
+	}
+
+	buf := arr.Get("buffer")
+	defer buf.Free()
+
+	require.NoError(t, buf.Detach())
+	require.EqualValues(t, 0, arr.Len())
+
+	_, err = buf.ToBytes()
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "detached")
+
+	_, err = arr.ToBytes()
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "detached")
+
+	require.EqualError(t, arr.Detach(), "value is not an ArrayBuffer")
+
+	str := context.String("not bytes")
+	defer str.Free()
+
+	_, err = str.ToBytes()
+	require.EqualError(t, err, "value is not an ArrayBuffer or typed array")
+}
+
+func TestMaxStackSizeDisabled(t *testing.T) {
+	runtime := NewRuntime()
+	defer runtime.Free()
+
+	runtime.SetMaxStackSize(0)
+
+	context := runtime.NewContext()
+	defer context.Free()
+
+	result, err := context.Eval(`1 + 1`)
+	require.NoError(t, err)
+	require.EqualValues(t, 2, result.Int32())
+
+	depth, err := context.Eval(`function depth(n) { return n === 0 ? 0 : 1 + depth(n - 1); } depth(1000)`)
+	require.NoError(t, err)
+	require.EqualValues(t, 1000, depth.Int32())
+}
+
+func TestStackOverflowIsRangeError(t *testing.T) {
+	runtime := NewRuntime()
+	defer runtime.Free()
+
+	context := runtime.NewContext()
+	defer context.Free()
+
+	result, err := context.Eval(`
+		function f() { return f(); }
+		try { f(); } catch (err) { err instanceof RangeError && err.message }
+	`)
+	require.NoError(t, err)
+	defer result.Free()
+	require.EqualValues(t, "stack overflow", result.String())
+}
+
+func TestStackTraceLines(t *testing.T) {
+	runtime := NewRuntime()
+	defer runtime.Free()
+
+	context := runtime.NewContext()
+	defer context.Free()
+
+	_, err := context.EvalFile("function f() { throw new Error('fail') }\n\nfunction g(args) { f(...args) }\ng([])", "lines.js")
+	require.Error(t, err)
+
+	var evalErr *Error
+	require.True(t, errors.As(err, &evalErr))
+	require.Contains(t, evalErr.Stack, "at f (lines.js:1)")
+	require.Contains(t, evalErr.Stack, "at g (lines.js:3)")
+}
+
+func TestStackCheckAcrossThreads(t *testing.T) {
+	runtime := NewRuntime()
+	defer runtime.Free()
+
+	context := runtime.NewContext()
+	defer context.Free()
+
+	depth := func() {
+		result, err := context.Eval(`function depth(n) { return n === 0 ? 0 : 1 + depth(n - 1); } depth(100)`)
+		require.NoError(t, err)
+		require.EqualValues(t, 100, result.Int32())
+
+		_, err = context.Eval(`function f() { return f(); } f()`)
+		require.EqualError(t, err, "RangeError: stack overflow")
+	}
+
+	for i := 0; i < 4; i++ {
+		done := make(chan struct{})
+		go func() {
+			defer close(done)
+
+			stdruntime.LockOSThread()
+			defer stdruntime.UnlockOSThread()
+
+			depth()
+		}()
+		<-done
+	}
+}
+
+func TestNewPromiseNeverSettled(t *testing.T) {
+	runtime := NewRuntime()
+	defer runtime.Free()
+
+	context := runtime.NewContext()
+
+	for i := 0; i < 10; i++ {
+		promise, _, reject := context.NewPromise()
+		promise.Free()
+
+		if i%2 == 0 {
+			reject(context.String("abandoned"))
+		}
+	}
+
+	promise, resolve, _ := context.NewPromise()
+	promise.Free()
+
+	require.Len(t, context.capabilities, 6)
+
+	context.Free()
+
+	resolve(context.Undefined())
+}
+
+func TestBinaryClassChecks(t *testing.T) {
+	runtime := NewRuntime()
+	defer runtime.Free()
+
+	context := runtime.NewContext()
+	defer context.Free()
+
+	values, err := context.Eval(`
+		const values = [new ArrayBuffer(2), new Uint8Array([1, 2]), new Int16Array([-3, 4]), new Date(0)];
+		for (const name of ["ArrayBuffer", "Uint8Array", "Int16Array", "Date"]) delete globalThis[name];
+		globalThis.Uint8Array = function() { return { spoofed: true }; };
+		values
+	`)
+	require.NoError(t, err)
+	defer values.Free()
+
+	buf, bytes, ints, date := values.GetByUint32(0), values.GetByUint32(1), values.GetByUint32(2), values.GetByUint32(3)
+	defer buf.Free()
+	defer bytes.Free()
+	defer ints.Free()
+	defer date.Free()
+
+	b, err := bytes.ToBytes()
+	require.NoError(t, err)
+	require.EqualValues(t, []byte{1, 2}, b)
+
+	min, max, _, _, err := ints.NumericStats()
+	require.NoError(t, err)
+	require.EqualValues(t, -3, min)
+	require.EqualValues(t, 4, max)
+
+	var decoded interface{}
+	require.NoError(t, bytes.Unmarshal(&decoded))
+	require.EqualValues(t, []byte{1, 2}, decoded)
+
+	require.NoError(t, buf.Detach())
+
+	object := context.Object()
+	defer object.Free()
+
+	_, err = object.ToBytes()
+	require.EqualError(t, err, "value is not an ArrayBuffer or typed array")
+
+	created := context.Uint8Array([]byte{5})
+	defer created.Free()
+	require.True(t, created.isUint8Array())
+
+	now, err := context.Marshal(time.Unix(1, 0))
+	require.NoError(t, err)
+	defer now.Free()
+	require.True(t, now.IsDate())
+	require.EqualValues(t, 1000, now.Float64())
+
+	isolated, err := context.EvalWithOptions(`new Uint8Array([7, 8])`, EvalOptions{IsolatedGlobals: true})
+	require.NoError(t, err)
+	defer isolated.Free()
+
+	b, err = isolated.ToBytes()
+	require.NoError(t, err)
+	require.EqualValues(t, []byte{7, 8}, b)
+}
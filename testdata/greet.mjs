@@ -0,0 +1,3 @@
+const greet = (name) => `Hello, ${name}!`;
+
+globalThis.greeting = greet("embed");